@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"kryptr/utils"
+)
+
+// Huffman adaptativo (algoritmo FGK). Codificador y decodificador parten del
+// mismo árbol, que solo tiene el nodo NYT ("aún no transmitido"), y lo
+// actualizan tras cada símbolo, así que no hace falta contar frecuencias ni
+// guardar la tabla: basta una pasada y la entrada puede venir de un flujo.
+//
+// Un símbolo nuevo se emite como el código de NYT seguido de sus 9 bits. El
+// símbolo 256 marca el final de los datos.
+const (
+	ahuffSymbols = 257
+	ahuffEOF     = 256
+	ahuffSymBits = 9
+)
+
+// ahuffNode es un nodo del árbol. Los nodos se guardan ordenados por número
+// de orden (índice 0 = raíz) y con peso no creciente, la propiedad de hermanos.
+type ahuffNode struct {
+	weight      uint64
+	parent      int32
+	left, right int32 // -1 en las hojas
+	symbol      int32
+}
+
+type adaptiveHuffman struct {
+	nodes []ahuffNode
+	leaf  [ahuffSymbols]int32 // posición de la hoja de cada símbolo, o -1
+	nyt   int32
+	path  []byte
+}
+
+func newAdaptiveHuffman() *adaptiveHuffman {
+	h := &adaptiveHuffman{nodes: make([]ahuffNode, 1, 2*ahuffSymbols)}
+	h.nodes[0] = ahuffNode{parent: -1, left: -1, right: -1, symbol: -1}
+	for i := range h.leaf {
+		h.leaf[i] = -1
+	}
+	return h
+}
+
+// swap intercambia los subárboles en las posiciones a y b; cada posición
+// conserva su padre.
+func (h *adaptiveHuffman) swap(a, b int32) {
+	pa, pb := h.nodes[a].parent, h.nodes[b].parent
+	h.nodes[a], h.nodes[b] = h.nodes[b], h.nodes[a]
+	h.nodes[a].parent, h.nodes[b].parent = pa, pb
+	for _, i := range [2]int32{a, b} {
+		if n := h.nodes[i]; n.left >= 0 {
+			h.nodes[n.left].parent = i
+			h.nodes[n.right].parent = i
+		} else if n.symbol >= 0 {
+			h.leaf[n.symbol] = i
+		}
+	}
+}
+
+// update incorpora una aparición de sym al árbol.
+func (h *adaptiveHuffman) update(sym int) {
+	q := h.leaf[sym]
+	if q < 0 {
+		// NYT se divide en un NYT nuevo (izquierda) y la hoja del símbolo (derecha)
+		old := h.nyt
+		q = int32(len(h.nodes))
+		h.nyt = q + 1
+		h.nodes = append(h.nodes,
+			ahuffNode{parent: old, left: -1, right: -1, symbol: int32(sym)},
+			ahuffNode{parent: old, left: -1, right: -1, symbol: -1})
+		h.nodes[old].left, h.nodes[old].right = h.nyt, q
+		h.leaf[sym] = q
+	}
+	for q != 0 {
+		// Líder del bloque: el nodo de mayor orden con el mismo peso
+		leader := q
+		for leader > 0 && h.nodes[leader-1].weight == h.nodes[q].weight {
+			leader--
+		}
+		if leader != q && leader != h.nodes[q].parent {
+			h.swap(leader, q)
+			q = leader
+		}
+		h.nodes[q].weight++
+		q = h.nodes[q].parent
+	}
+	h.nodes[0].weight++
+}
+
+// writeNode escribe el camino desde la raíz hasta el nodo n.
+func (h *adaptiveHuffman) writeNode(w *utils.StreamBitWriter, n int32) error {
+	h.path = h.path[:0]
+	for n != 0 {
+		p := h.nodes[n].parent
+		if h.nodes[p].right == n {
+			h.path = append(h.path, 1)
+		} else {
+			h.path = append(h.path, 0)
+		}
+		n = p
+	}
+	for i := len(h.path) - 1; i >= 0; {
+		var v uint64
+		k := uint8(0)
+		for ; k < 56 && i >= 0; k, i = k+1, i-1 {
+			v = v<<1 | uint64(h.path[i])
+		}
+		if err := w.WriteBits(v, k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (h *adaptiveHuffman) encode(w *utils.StreamBitWriter, sym int) error {
+	if q := h.leaf[sym]; q >= 0 {
+		return h.writeNode(w, q)
+	}
+	if err := h.writeNode(w, h.nyt); err != nil {
+		return err
+	}
+	return w.WriteBits(uint64(sym), ahuffSymBits)
+}
+
+func (h *adaptiveHuffman) decode(r *utils.StreamBitReader) (int, error) {
+	n := int32(0)
+	for h.nodes[n].left >= 0 {
+		bit := r.Peek(1)
+		if err := r.Consume(1); err != nil {
+			return 0, err
+		}
+		if bit == 1 {
+			n = h.nodes[n].right
+		} else {
+			n = h.nodes[n].left
+		}
+	}
+	if n != h.nyt {
+		return int(h.nodes[n].symbol), nil
+	}
+	sym, err := r.ReadBits(ahuffSymBits)
+	if err != nil {
+		return 0, err
+	}
+	if sym >= ahuffSymbols || (sym != ahuffEOF && h.leaf[sym] >= 0) {
+		return 0, fmt.Errorf("símbolo nuevo inválido: %d", sym)
+	}
+	return int(sym), nil
+}
+
+// adaptiveHuffmanEncode comprime src en dst en una sola pasada.
+func adaptiveHuffmanEncode(dst io.Writer, src io.Reader) error {
+	in := bufio.NewReader(src)
+	w := utils.NewStreamBitWriter(dst)
+	h := newAdaptiveHuffman()
+	for {
+		b, err := in.ReadByte()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if err := h.encode(w, int(b)); err != nil {
+			return err
+		}
+		h.update(int(b))
+	}
+	if err := h.encode(w, ahuffEOF); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+// adaptiveHuffmanDecode invierte adaptiveHuffmanEncode escribiendo en dst a
+// medida que decodifica.
+func adaptiveHuffmanDecode(dst io.Writer, src io.Reader) error {
+	out := bufio.NewWriter(dst)
+	r := utils.NewStreamBitReader(src)
+	h := newAdaptiveHuffman()
+	for {
+		sym, err := h.decode(r)
+		if err == io.ErrUnexpectedEOF {
+			return fmt.Errorf("datos de Huffman adaptativo truncados")
+		}
+		if err != nil {
+			return err
+		}
+		if sym == ahuffEOF {
+			return out.Flush()
+		}
+		if err := out.WriteByte(byte(sym)); err != nil {
+			return err
+		}
+		h.update(sym)
+	}
+}
+
+func adaptiveHuffmanCompress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	err := adaptiveHuffmanEncode(&buf, bytes.NewReader(data))
+	return buf.Bytes(), err
+}
+
+func adaptiveHuffmanDecompress(payload []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	err := adaptiveHuffmanDecode(&buf, bytes.NewReader(payload))
+	return buf.Bytes(), err
+}
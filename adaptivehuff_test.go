@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"testing/iotest"
+)
+
+func TestAdaptiveRoundTrip(t *testing.T) {
+	for name, data := range testInputs() {
+		packed, err := adaptiveHuffmanCompress(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := adaptiveHuffmanDecompress(packed)
+		if err != nil {
+			t.Fatalf("entrada %q: %v", name, err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Fatalf("entrada %q no coincide", name)
+		}
+		// Sin el símbolo final la carga debe detectarse como truncada
+		if len(packed) > 1 {
+			if _, err := adaptiveHuffmanDecompress(packed[:len(packed)/2]); err == nil {
+				t.Fatalf("entrada %q: carga truncada aceptada", name)
+			}
+		}
+	}
+}
+
+// TestAdaptiveStream comprime y descomprime leyendo de a un byte, como llega
+// una tubería lenta, y compara con la versión en memoria.
+func TestAdaptiveStream(t *testing.T) {
+	data := testInputs()["sesgado"]
+	var packed, plain bytes.Buffer
+	if err := adaptiveHuffmanEncode(&packed, iotest.OneByteReader(bytes.NewReader(data))); err != nil {
+		t.Fatal(err)
+	}
+	if mem, _ := adaptiveHuffmanCompress(data); !bytes.Equal(packed.Bytes(), mem) {
+		t.Fatal("el flujo difiere de la compresión en memoria")
+	}
+	if err := adaptiveHuffmanDecode(&plain, iotest.OneByteReader(&packed)); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(plain.Bytes(), data) {
+		t.Fatal("la salida no coincide")
+	}
+}
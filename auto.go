@@ -0,0 +1,143 @@
+package main
+
+import "math"
+
+// Selección automática del método (--comp-alg auto): se mide la entropía y
+// la repetición de una muestra del archivo y, salvo que parezca incompresible,
+// se comprime la muestra con cada candidato.
+
+// Tamaño de la muestra. Un archivo mayor se muestrea en autoSampleChunks
+// tramos repartidos por todo el archivo, para que un principio distinto del
+// resto (una cabecera, un tramo binario) no decida por todo el archivo.
+const (
+	autoSampleSize   = 128 * 1024
+	autoSampleChunks = 8
+)
+
+// Un método más rápido se prefiere si su muestra ocupa como mucho esta
+// fracción más que la del mejor.
+const autoSlack = 0.03
+
+// Candidatos de auto, del más rápido al más lento según `go test -bench` y el
+// tiempo de compresión sobre texto mixto. ahuff y lzw no se prueban: huff y
+// deflate comprimen más y más rápido sobre los mismos datos.
+var autoCandidates = []byte{methodHuffman, methodLZSS, methodDeflate, methodRange, methodBWT}
+
+// byteEntropy devuelve la entropía de orden 0 de data en bits por byte.
+func byteEntropy(data []byte) float64 {
+	var freq [256]int
+	for _, b := range data {
+		freq[b]++
+	}
+	h := 0.0
+	for _, f := range freq {
+		if f > 0 {
+			p := float64(f) / float64(len(data))
+			h -= p * math.Log2(p)
+		}
+	}
+	return h
+}
+
+// repetitiveness devuelve la fracción de posiciones de data cuyos 4 bytes
+// siguientes ya aparecieron antes, una estimación barata de lo que puede
+// aprovechar un compresor LZ.
+func repetitiveness(data []byte) float64 {
+	if len(data) < 4 {
+		return 0
+	}
+	const hashBits = 16
+	last := make([]int32, 1<<hashBits)
+	for i := range last {
+		last[i] = -1
+	}
+	hits := 0
+	for i := 0; i+4 <= len(data); i++ {
+		v := uint32(data[i]) | uint32(data[i+1])<<8 | uint32(data[i+2])<<16 | uint32(data[i+3])<<24
+		h := (v * 2654435761) >> (32 - hashBits)
+		if j := last[h]; j >= 0 && string(data[j:j+4]) == string(data[i:i+4]) {
+			hits++
+		}
+		last[h] = int32(i)
+	}
+	return float64(hits) / float64(len(data)-3)
+}
+
+// autoTrial es el resultado de comprimir la muestra con un candidato.
+type autoTrial struct {
+	method byte
+	size   int
+}
+
+// chooseMethod elige el método para data. Con entropía cercana a 8 bits por
+// byte y sin repeticiones (datos comprimidos o cifrados) guarda sin comprimir
+// sin probar nada; si no, comprime la muestra con cada candidato y se queda
+// con el más rápido de los que quedan a autoSlack del mejor.
+func chooseMethod(data []byte) (byte, []autoTrial) {
+	sample := autoSample(data)
+	if len(sample) == 0 || byteEntropy(sample) > 7.9 && repetitiveness(sample) < 0.01 {
+		return methodStored, nil
+	}
+
+	candidates := autoCandidates
+	if sharedDict != nil {
+		// Con un diccionario entrenado, dict es el candidato más rápido
+		candidates = append([]byte{methodDict}, candidates...)
+	}
+	trials := make([]autoTrial, 0, len(candidates))
+	for _, m := range candidates {
+		payload, err := compressPayload(sample, m)
+		if err == nil {
+			trials = append(trials, autoTrial{m, len(payload)})
+		}
+	}
+	return pickTrial(trials, len(sample)), trials
+}
+
+// autoSample devuelve data entero si cabe en la muestra o, si no, la
+// concatenación de autoSampleChunks tramos equiespaciados, el primero al
+// principio y el último al final del archivo.
+func autoSample(data []byte) []byte {
+	if len(data) <= autoSampleSize {
+		return data
+	}
+	chunk := autoSampleSize / autoSampleChunks
+	sample := make([]byte, 0, autoSampleSize)
+	for i := 0; i < autoSampleChunks; i++ {
+		start := i * (len(data) - chunk) / (autoSampleChunks - 1)
+		sample = append(sample, data[start:start+chunk]...)
+	}
+	return sample
+}
+
+// pickTrial elige entre las pruebas, ordenadas del candidato más rápido al
+// más lento, la primera que queda a autoSlack de la mejor. Si ninguna reduce
+// la muestra de size bytes, guarda sin comprimir.
+func pickTrial(trials []autoTrial, size int) byte {
+	if len(trials) == 0 {
+		return methodStored
+	}
+	best := trials[0].size
+	for _, t := range trials {
+		best = min(best, t.size)
+	}
+	if best >= size {
+		return methodStored
+	}
+	for _, t := range trials {
+		if float64(t.size) <= float64(best)*(1+autoSlack) {
+			return t.method
+		}
+	}
+	return trials[0].method
+}
+
+// methodName devuelve el nombre de --comp-alg de un método.
+func methodName(method byte) string {
+	for name, m := range compressionMethods {
+		if m == method {
+			return name
+		}
+	}
+	return string(method)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// TestAutoSelect comprueba las estimaciones de chooseMethod, la regla de
+// elección con pruebas fijas y el método que sale para cada entrada de prueba.
+func TestAutoSelect(t *testing.T) {
+	inputs := testInputs()
+	if h := byteEntropy(inputs["alfabeto"]); math.Abs(h-8) > 1e-9 {
+		t.Fatalf("entropía del alfabeto %.3f, esperado 8", h)
+	}
+	if h := byteEntropy(inputs["repetido"]); h != 0 {
+		t.Fatalf("entropía de un solo byte %.3f, esperado 0", h)
+	}
+	if r := repetitiveness(inputs["aleatorio"]); r > 0.01 {
+		t.Fatalf("repetición de datos aleatorios %.3f", r)
+	}
+	if r := repetitiveness(inputs["texto"]); r < 0.9 {
+		t.Fatalf("repetición del texto %.3f", r)
+	}
+
+	// La regla de elección con pruebas fijas: el más rápido dentro del margen
+	for _, c := range []struct {
+		name   string
+		trials []autoTrial
+		size   int
+		want   byte
+	}{
+		{"sin pruebas", nil, 100, methodStored},
+		{"el mejor", []autoTrial{{methodHuffman, 80}, {methodLZSS, 50}, {methodBWT, 40}}, 100, methodBWT},
+		{"dentro del margen", []autoTrial{{methodHuffman, 1030}, {methodLZSS, 1100}, {methodBWT, 1000}}, 4000, methodHuffman},
+		{"fuera del margen", []autoTrial{{methodHuffman, 1031}, {methodLZSS, 1020}, {methodBWT, 1000}}, 4000, methodLZSS},
+		{"no reduce", []autoTrial{{methodHuffman, 120}, {methodLZSS, 100}}, 100, methodStored},
+	} {
+		if got := pickTrial(c.trials, c.size); got != c.want {
+			t.Fatalf("regla %s: elegido %q, esperado %q", c.name, got, c.want)
+		}
+	}
+
+	// Y sobre las entradas de prueba, con los métodos que salen con los
+	// candidatos y el margen actuales: si cambian, hay que revisar la tabla
+	want := map[string]byte{
+		"vacío":     methodStored,
+		"un byte":   methodStored,
+		"repetido":  methodDeflate,
+		"alfabeto":  methodStored,
+		"texto":     methodRange,
+		"sesgado":   methodHuffman,
+		"aleatorio": methodStored,
+	}
+	if m, trials := chooseMethod(inputs["aleatorio"]); trials != nil {
+		t.Fatalf("datos aleatorios: %d pruebas con %q, esperado ninguna", len(trials), m)
+	}
+	for name, data := range inputs {
+		m, _ := chooseMethod(data)
+		if m != want[name] {
+			t.Fatalf("%s: elegido %q, esperado %q", name, m, want[name])
+		}
+		packed, err := PackWithMeta(data, name, m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, got, err := decompressContainer(packed); err != nil || !bytes.Equal(got, data) {
+			t.Fatalf("%s: ida y vuelta con %q: %v", name, m, err)
+		}
+	}
+}
+
+// TestAutoMixed usa un archivo que empieza con 160 KB de datos sesgados,
+// donde gana huff, seguidos de 1 MB de log, donde huff ocupa cinco veces
+// más que bwt. La muestra repartida por todo el archivo debe elegir un
+// método cercano al mejor para el archivo entero.
+func TestAutoMixed(t *testing.T) {
+	rng := rand.New(rand.NewSource(46))
+	head := make([]byte, 160*1024)
+	for i := range head {
+		if rng.Intn(16) == 0 {
+			head[i] = byte(rng.Intn(256))
+		} else {
+			head[i] = 'a' + byte(rng.Intn(3))
+		}
+	}
+	data := append(head, logInput(1<<20)...)
+
+	sample := autoSample(data)
+	chunk := autoSampleSize / autoSampleChunks
+	if len(sample) != autoSampleSize || !bytes.Equal(sample[:chunk], data[:chunk]) ||
+		!bytes.Equal(sample[len(sample)-chunk:], data[len(data)-chunk:]) {
+		t.Fatalf("muestra de %d bytes sin el principio o el final del archivo", len(sample))
+	}
+
+	m, _ := chooseMethod(data)
+	sizes := make(map[byte]int)
+	best := len(data)
+	for _, c := range autoCandidates {
+		packed, err := PackWithMeta(data, "mixto", c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sizes[c] = len(packed)
+		best = min(best, len(packed))
+	}
+	if float64(sizes[m]) > float64(best)*1.1 {
+		t.Fatalf("elegido %q con %d bytes, el mejor ocupa %d", m, sizes[m], best)
+	}
+}
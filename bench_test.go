@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+// Pruebas de rendimiento, fuera del binario: go test -bench . -benchmem
+
+// decodeSymbolsMap es el decodificador original: acumula un bit a la vez y
+// busca el prefijo en el diccionario. Es la referencia del decodificador por tabla.
+func decodeSymbolsMap(dict map[string]byte, data []byte, lenMessage int) []byte {
+	var out []byte
+	var current string
+	symbolsRead := 0
+	for _, b := range data {
+		for i := 7; i >= 0; i-- {
+			if symbolsRead >= lenMessage {
+				return out
+			}
+			bit := (b >> i) & 1
+			if bit == 1 {
+				current += "1"
+			} else {
+				current += "0"
+			}
+
+			if val, ok := dict[current]; ok {
+				out = append(out, val)
+				current = ""
+				symbolsRead++
+			}
+		}
+	}
+	return out
+}
+
+// BenchmarkHuffmanDecode compara el decodificador por tabla con el original
+// basado en map[string]byte.
+func BenchmarkHuffmanDecode(b *testing.B) {
+	data := logInput(4 << 20)
+	dict, lenMessage, body, err := parseHuffmanHeader(huffmanCompressSingle(data))
+	if err != nil {
+		b.Fatal(err)
+	}
+	strDict := make(map[string]byte)
+	for code, s := range dict {
+		strDict[fmt.Sprintf("%0*b", code.length, code.bits)] = s
+	}
+
+	cases := []struct {
+		name   string
+		decode func() []byte
+	}{
+		{"map", func() []byte { return decodeSymbolsMap(strDict, body, int(lenMessage)) }},
+		{"tabla", func() []byte {
+			out, _ := decodeSymbolsTable(buildHuffmanTable(dict), body, int(lenMessage))
+			return out
+		}},
+	}
+	for _, c := range cases {
+		b.Run(c.name, func(b *testing.B) {
+			if !bytes.Equal(c.decode(), data) {
+				b.Fatal("la salida no coincide")
+			}
+			b.SetBytes(int64(len(data)))
+			b.ReportAllocs()
+			b.ResetTimer()
+			for n := 0; n < b.N; n++ {
+				c.decode()
+			}
+		})
+	}
+}
+
+// BenchmarkCompress mide cada compresor sobre el mismo log e informa en
+// "ratio" de la fracción del original que ocupa la carga. Para comparar el
+// tamaño con archivos propios está `kryptr stats --comp-alg`.
+func BenchmarkCompress(b *testing.B) {
+	data := logInput(1 << 20)
+	methods := []struct {
+		name     string
+		compress func([]byte) ([]byte, error)
+	}{
+		{"huff", func(d []byte) ([]byte, error) { return huffmanCompress(d), nil }},
+		{"huff-una-tabla", func(d []byte) ([]byte, error) { return huffmanCompressSingle(d), nil }},
+		{"lzss", func(d []byte) ([]byte, error) { return lzssCompress(d, lzssConfig) }},
+		{"deflate", func(d []byte) ([]byte, error) { return deflateCompress(d, lzssConfig), nil }},
+		{"range-o0", func(d []byte) ([]byte, error) { return rangeCompress(d, rangeOrder0, lzssConfig) }},
+		{"range-o1", func(d []byte) ([]byte, error) { return rangeCompress(d, rangeOrder1, lzssConfig) }},
+		{"range-lz", func(d []byte) ([]byte, error) { return rangeCompress(d, rangeLZ, lzssConfig) }},
+		{"bwt", func(d []byte) ([]byte, error) { return bwtCompress(d, bwtBlockSize, bwtEntropy) }},
+	}
+	for _, m := range methods {
+		b.Run(m.name, func(b *testing.B) {
+			packed, err := m.compress(data)
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.SetBytes(int64(len(data)))
+			b.ResetTimer()
+			for n := 0; n < b.N; n++ {
+				m.compress(data)
+			}
+			b.ReportMetric(float64(len(packed))/float64(len(data)), "ratio")
+		})
+	}
+}
+
+// BenchmarkInflate mide inflate sobre la salida de deflateCompress, con un
+// log (sobre todo coincidencias) y con bytes sin repeticiones (solo
+// literales), y dictDecode sobre registros JSON con un diccionario entrenado.
+func BenchmarkInflate(b *testing.B) {
+	rng := rand.New(rand.NewSource(2004))
+	literals := make([]byte, 1<<20)
+	for i := range literals {
+		literals[i] = byte(rng.NormFloat64()*20 + 128)
+	}
+	for _, c := range []struct {
+		name string
+		data []byte
+	}{{"deflate", logInput(1 << 20)}, {"deflate-literales", literals}} {
+		packed := deflateCompress(c.data, lzssConfig)
+		b.Run(c.name, func(b *testing.B) {
+			b.SetBytes(int64(len(c.data)))
+			b.ResetTimer()
+			for n := 0; n < b.N; n++ {
+				if _, _, err := inflate(packed); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+
+	d, err := trainDictionary(dictSamples(rng, 200), dictDefaultSize)
+	if err != nil {
+		b.Fatal(err)
+	}
+	var records []byte
+	for len(records) < 64*1024 {
+		records = append(records, dictSamples(rng, 1)[0]...)
+	}
+	bits := dictEncode(records, d)
+	b.Run("dict", func(b *testing.B) {
+		b.SetBytes(int64(len(records)))
+		b.ResetTimer()
+		for n := 0; n < b.N; n++ {
+			if _, err := dictDecode(bits, uint64(len(records)), d); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,348 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Compresor por ordenamiento de bloques al estilo de bzip2: cada bloque pasa
+// por la transformada de Burrows-Wheeler, move-to-front y una codificación de
+// las rachas de ceros, y el resultado se comprime con huffmanCompress o, en
+// los niveles -8 y -9, con el codificador de rango de orden 0.
+
+// Tamaño de bloque usado por comprimir, como el de bzip2 -9.
+var bwtBlockSize = 900 * 1000
+
+// Codificador de la última etapa (methodHuffman o methodRange). Sobre
+// fuentes de Go, range ocupa un 4 % menos y tarda siete veces más en esa etapa.
+var bwtEntropy = methodHuffman
+
+// Bit del tamaño de bloque del encabezado que indica que los bloques van con
+// el codificador de rango. Los archivos sin él se leen como siempre.
+const bwtRangeCoded = 1 << 31
+
+// Tamaño de bloque máximo del formato. Acota la memoria que puede pedir el
+// encabezado de un archivo dañado.
+const bwtMaxBlockSize = 1 << 24
+
+// Símbolos tras MTF: las rachas de ceros se escriben en base 2 biyectiva con
+// bwtRunA (1) y bwtRunB (2); un valor MTF v se escribe como v+1, y desde
+// bwtEscape se usa un byte de escape seguido del valor.
+const (
+	bwtRunA   = 0
+	bwtRunB   = 1
+	bwtEscape = 255
+)
+
+// suffixArray ordena los sufijos de s por duplicación de prefijos con
+// ordenamiento por conteo: O(n log n). Un sufijo que es prefijo de otro va
+// primero, como si s terminara con un centinela menor que cualquier byte.
+func suffixArray(s []byte) []int32 {
+	n := len(s)
+	sa := make([]int32, n)
+	if n == 0 {
+		return sa
+	}
+	rank := make([]int32, n)
+	tmp := make([]int32, n)
+	count := make([]int32, max(256, n)+1)
+
+	for i, c := range s {
+		count[int(c)+1]++
+		rank[i] = int32(c)
+	}
+	for i := 1; i <= 256; i++ {
+		count[i] += count[i-1]
+	}
+	for i, c := range s {
+		sa[count[c]] = int32(i)
+		count[c]++
+	}
+
+	classes := int32(256)
+	for k := 1; ; k <<= 1 {
+		// Orden por la segunda mitad: los sufijos sin segunda mitad primero
+		p := 0
+		for i := max(n-k, 0); i < n; i++ {
+			tmp[p] = int32(i)
+			p++
+		}
+		for _, j := range sa {
+			if int(j) >= k {
+				tmp[p] = j - int32(k)
+				p++
+			}
+		}
+
+		// Orden estable por la primera mitad
+		for i := range count[:classes+1] {
+			count[i] = 0
+		}
+		for _, j := range tmp {
+			count[rank[j]+1]++
+		}
+		for i := int32(1); i <= classes; i++ {
+			count[i] += count[i-1]
+		}
+		for _, j := range tmp {
+			sa[count[rank[j]]] = j
+			count[rank[j]]++
+		}
+
+		// Nuevas clases: pares (rank[i], rank[i+k]) distintos
+		second := func(i int32) int32 {
+			if int(i)+k < n {
+				return rank[int(i)+k]
+			}
+			return -1
+		}
+		tmp[sa[0]] = 0
+		for i := 1; i < n; i++ {
+			a, b := sa[i-1], sa[i]
+			tmp[b] = tmp[a]
+			if rank[a] != rank[b] || second(a) != second(b) {
+				tmp[b]++
+			}
+		}
+		rank, tmp = tmp, rank
+		classes = rank[sa[n-1]] + 1
+		if int(classes) == n {
+			return sa
+		}
+	}
+}
+
+// bwtForward devuelve la última columna de la matriz ordenada de s más un
+// centinela, sin la fila del centinela, y la posición de esa fila.
+func bwtForward(s []byte) ([]byte, int) {
+	sa := suffixArray(s)
+	n := len(s)
+	last := make([]byte, 0, n)
+	// La fila 0 es el sufijo vacío (solo el centinela): su último símbolo es s[n-1]
+	last = append(last, s[n-1])
+	primary := 0
+	for r, j := range sa {
+		if j == 0 {
+			primary = r + 1
+			continue
+		}
+		last = append(last, s[j-1])
+	}
+	return last, primary
+}
+
+// bwtInverse reconstruye s a partir de bwtForward.
+func bwtInverse(last []byte, primary int) ([]byte, error) {
+	n := len(last)
+	if primary < 1 || primary > n {
+		return nil, fmt.Errorf("índice primario BWT inválido: %d", primary)
+	}
+	// Símbolo de cada fila de la matriz de n+1 filas; -1 es el centinela
+	sym := func(r int) int {
+		switch {
+		case r == primary:
+			return -1
+		case r > primary:
+			return int(last[r-1])
+		}
+		return int(last[r])
+	}
+
+	var start [256]int
+	for _, c := range last {
+		start[c]++
+	}
+	sum := 1 // la fila 0 de la primera columna es el centinela
+	for c := range start {
+		start[c], sum = sum, sum+start[c]
+	}
+
+	// lf[r]: fila cuyo sufijo empieza con el símbolo de la fila r
+	lf := make([]int32, n+1)
+	for r := 0; r <= n; r++ {
+		if c := sym(r); c >= 0 {
+			lf[r] = int32(start[c])
+			start[c]++
+		}
+	}
+
+	out := make([]byte, n)
+	r := 0
+	for i := n - 1; i >= 0; i-- {
+		c := sym(r)
+		if c < 0 {
+			return nil, fmt.Errorf("datos BWT inconsistentes")
+		}
+		out[i] = byte(c)
+		r = int(lf[r])
+	}
+	return out, nil
+}
+
+// mtfEncode aplica move-to-front y codifica las rachas de ceros.
+func mtfEncode(data []byte) []byte {
+	var order [256]byte
+	for i := range order {
+		order[i] = byte(i)
+	}
+	out := make([]byte, 0, len(data))
+	run := 0
+	flushRun := func() {
+		// Base 2 biyectiva: dígitos 1 (RUNA) y 2 (RUNB), del menos significativo
+		for ; run > 0; run = (run - 1) / 2 {
+			out = append(out, byte(bwtRunA+(run-1)%2))
+		}
+	}
+	for _, c := range data {
+		v := 0
+		for order[v] != c {
+			v++
+		}
+		if v == 0 {
+			run++
+			continue
+		}
+		flushRun()
+		copy(order[1:v+1], order[:v])
+		order[0] = c
+		if v+1 < bwtEscape {
+			out = append(out, byte(v+1))
+		} else {
+			out = append(out, bwtEscape, byte(v))
+		}
+	}
+	flushRun()
+	return out
+}
+
+// mtfDecode invierte mtfEncode; n es la longitud esperada de la salida.
+func mtfDecode(syms []byte, n int) ([]byte, error) {
+	var order [256]byte
+	for i := range order {
+		order[i] = byte(i)
+	}
+	out := make([]byte, 0, n)
+	run, weight := 0, 1
+	for i := 0; i <= len(syms); i++ {
+		if i < len(syms) && syms[i] <= bwtRunB {
+			run += weight << syms[i]
+			weight <<= 1
+			if run > n {
+				return nil, fmt.Errorf("racha MTF excede el bloque")
+			}
+			continue
+		}
+		for ; run > 0; run-- {
+			out = append(out, order[0])
+		}
+		weight = 1
+		if i == len(syms) {
+			break
+		}
+
+		v := int(syms[i]) - 1
+		if syms[i] == bwtEscape {
+			if i+1 >= len(syms) {
+				return nil, fmt.Errorf("escape MTF truncado")
+			}
+			i++
+			v = int(syms[i])
+		}
+		c := order[v]
+		copy(order[1:v+1], order[:v])
+		order[0] = c
+		out = append(out, c)
+	}
+	if len(out) != n {
+		return nil, fmt.Errorf("bloque MTF de %d bytes, esperado %d", len(out), n)
+	}
+	return out, nil
+}
+
+// bwtCompress comprime data por bloques de blockSize bytes; entropy es el
+// codificador de la última etapa.
+// Formato: longitud original uint64 BE | tamaño de bloque uint32 BE, con
+// bwtRangeCoded si entropy es methodRange | por bloque: índice primario
+// uint32 BE | longitud de la carga uint32 BE | carga de huffmanCompress o de
+// rangeCompress de orden 0 con los símbolos de mtfEncode.
+func bwtCompress(data []byte, blockSize int, entropy byte) ([]byte, error) {
+	if blockSize < 1 || blockSize > bwtMaxBlockSize {
+		return nil, fmt.Errorf("tamaño de bloque BWT fuera de rango: %d", blockSize)
+	}
+	header := uint32(blockSize)
+	switch entropy {
+	case methodHuffman:
+	case methodRange:
+		header |= bwtRangeCoded
+	default:
+		return nil, fmt.Errorf("codificador BWT no admitido: %q", entropy)
+	}
+	out := make([]byte, 12)
+	binary.BigEndian.PutUint64(out, uint64(len(data)))
+	binary.BigEndian.PutUint32(out[8:], header)
+
+	for off := 0; off < len(data); off += blockSize {
+		block := data[off:min(off+blockSize, len(data))]
+		last, primary := bwtForward(block)
+		syms := mtfEncode(last)
+		var payload []byte
+		if entropy == methodRange {
+			var err error
+			if payload, err = rangeCompress(syms, rangeOrder0, lzssConfig); err != nil {
+				return nil, err
+			}
+		} else {
+			payload = huffmanCompress(syms)
+		}
+		out = binary.BigEndian.AppendUint32(out, uint32(primary))
+		out = binary.BigEndian.AppendUint32(out, uint32(len(payload)))
+		out = append(out, payload...)
+	}
+	return out, nil
+}
+
+func bwtDecompress(payload []byte) ([]byte, error) {
+	if len(payload) < 12 {
+		return nil, fmt.Errorf("encabezado BWT incompleto")
+	}
+	size := binary.BigEndian.Uint64(payload)
+	blockSize := uint64(binary.BigEndian.Uint32(payload[8:]))
+	decode := huffmanDecode
+	if blockSize&bwtRangeCoded != 0 {
+		blockSize &^= bwtRangeCoded
+		decode = rangeDecompress
+	}
+	if blockSize == 0 || blockSize > bwtMaxBlockSize {
+		return nil, fmt.Errorf("tamaño de bloque BWT inválido: %d", blockSize)
+	}
+	rest := payload[12:]
+
+	out := make([]byte, 0, min(size, uint64(len(payload))*64))
+	for uint64(len(out)) < size {
+		if len(rest) < 8 {
+			return out, fmt.Errorf("datos BWT truncados: %d de %d bytes", len(out), size)
+		}
+		primary := int(binary.BigEndian.Uint32(rest))
+		plen := uint64(binary.BigEndian.Uint32(rest[4:]))
+		if plen > uint64(len(rest)-8) {
+			return out, fmt.Errorf("datos BWT truncados: %d de %d bytes", len(out), size)
+		}
+		syms, err := decode(rest[8 : 8+plen])
+		if err != nil {
+			return out, err
+		}
+		rest = rest[8+plen:]
+
+		n := int(min(blockSize, size-uint64(len(out))))
+		last, err := mtfDecode(syms, n)
+		if err != nil {
+			return out, err
+		}
+		block, err := bwtInverse(last, primary)
+		if err != nil {
+			return out, err
+		}
+		out = append(out, block...)
+	}
+	return out, nil
+}
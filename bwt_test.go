@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bytes"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+// TestSuffixArray compara suffixArray con un ordenamiento directo de los sufijos.
+func TestSuffixArray(t *testing.T) {
+	rng := rand.New(rand.NewSource(2004))
+	for n := 0; n < 200; n++ {
+		s := make([]byte, n)
+		for i := range s {
+			s[i] = 'a' + byte(rng.Intn(1+n%4))
+		}
+		want := make([]int, n)
+		for i := range want {
+			want[i] = i
+		}
+		sort.Slice(want, func(x, y int) bool { return bytes.Compare(s[want[x]:], s[want[y]:]) < 0 })
+		for i, j := range suffixArray(s) {
+			if int(j) != want[i] {
+				t.Fatalf("%q: posición %d es %d, esperado %d", s, i, j, want[i])
+			}
+		}
+	}
+}
+
+func TestBWTRoundTrip(t *testing.T) {
+	for _, entropy := range []byte{methodHuffman, methodRange} {
+		for _, blockSize := range []int{bwtBlockSize, 1000} {
+			for name, data := range testInputs() {
+				packed, err := bwtCompress(data, blockSize, entropy)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got, err := bwtDecompress(packed)
+				if err != nil {
+					t.Fatalf("entrada %q, %q, bloque %d: %v", name, entropy, blockSize, err)
+				}
+				if !bytes.Equal(got, data) {
+					t.Fatalf("entrada %q, %q, bloque %d no coincide", name, entropy, blockSize)
+				}
+			}
+		}
+	}
+}
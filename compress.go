@@ -1,8 +1,11 @@
 package main
 
 import (
+	"bytes"
+	"crypto/sha256"
 	"encoding/binary"
 	"fmt"
+	"hash/crc32"
 	"kryptr/utils"
 )
 
@@ -22,34 +25,26 @@ func buildHuffmanTree(heap *utils.MinHeap) *utils.Node {
 	return heap.Pop()
 }
 
-func serializeTree(root *utils.Node) []byte {
-    var out []byte
-    walk(root, &out)
-    return out
+// huffmanCode es un código de length bits, alineado a la derecha en bits.
+type huffmanCode struct {
+	bits   uint64
+	length uint8
 }
 
-func walk (n *utils.Node, out *[]byte)  {
-	    if n.Left == nil && n.Right == nil {
-            *out = append(*out, 1)
-            *out = append(*out, n.Symbol)
-            return
-        }
-
-        *out = append(*out, 0)
-        walk(n.Left, out)
-        walk(n.Right, out)
-		return
+// child devuelve el código del hijo izquierdo (bit 0) o derecho (bit 1).
+func (c huffmanCode) child(bit uint64) huffmanCode {
+	return huffmanCode{bits: c.bits<<1 | bit, length: c.length + 1}
 }
 
-func DeserializeToDict(data []byte) (map[string]byte, int) {
-	dict := make(map[string]byte)
+func DeserializeToDict(data []byte) (map[huffmanCode]byte, int) {
+	dict := make(map[huffmanCode]byte)
 	i := 0
-	if err := buildDict(data, &i, "", dict); err != nil {
+	if err := buildDict(data, &i, huffmanCode{}, dict); err != nil {
 		return nil, i
 	}
 	return dict, i
 }
-func buildDict(data []byte, index *int, prefix string, dict map[string]byte) error {
+func buildDict(data []byte, index *int, prefix huffmanCode, dict map[huffmanCode]byte) error {
 	if *index >= len(data) {
 		return fmt.Errorf("unexpected end of data while reading tree marker at index %d", *index)
 	}
@@ -67,125 +62,408 @@ func buildDict(data []byte, index *int, prefix string, dict map[string]byte) err
 	}
 
 	// Internal node → descend left as 0, right as 1
-	if err := buildDict(data, index, prefix+"0", dict); err != nil {
+	if err := buildDict(data, index, prefix.child(0), dict); err != nil {
 		return err
 	}
-	if err := buildDict(data, index, prefix+"1", dict); err != nil {
+	if err := buildDict(data, index, prefix.child(1), dict); err != nil {
 		return err
 	}
 	return nil
 }
 
-func createCompressionDictionary(tree *utils.Node, prefix string, compressionDict map[byte]string) {
+func createCompressionDictionary(tree *utils.Node, prefix huffmanCode, compressionDict map[int]huffmanCode) {
 	if tree.Left == nil && tree.Right == nil {
 		compressionDict[tree.Symbol] = prefix
 		return
 	}
 	if tree.Left != nil {
-		createCompressionDictionary(tree.Left, prefix+"0", compressionDict)
+		createCompressionDictionary(tree.Left, prefix.child(0), compressionDict)
 	}
 	if tree.Right != nil {
-		createCompressionDictionary(tree.Right, prefix+"1", compressionDict)
+		createCompressionDictionary(tree.Right, prefix.child(1), compressionDict)
+	}
+}
+
+// Marcador de formato de la carga Huffman. Los archivos anteriores empiezan
+// directamente con el árbol serializado (0 = nodo interno, 1 = hoja).
+const huffmanCanonical byte = 2
+
+// Longitud máxima de un código Huffman canónico.
+const huffmanMaxCodeLen = 15
+
+// Longitud máxima de un archivo del formato anterior con un solo símbolo. Su
+// árbol es una hoja con código vacío, así que la carga no tiene bits y solo la
+// longitud de 32 bits indica cuánto reservar.
+const huffmanMaxSingleLeaf = 64 << 20
+
+// huffmanCodeLengths calcula la longitud del código de cada símbolo de un
+// alfabeto de len(freq) símbolos. Si algún código supera maxLen, reduce a la
+// mitad las frecuencias y repite.
+func huffmanCodeLengths(freq []int, maxLen uint8) []uint8 {
+	freq = append([]int(nil), freq...)
+	lengths := make([]uint8, len(freq))
+	for {
+		heap := utils.BuildHeapFromFreq(freq)
+		if heap.Len() == 0 {
+			return lengths
+		}
+		huffManTree := buildHuffmanTree(&heap)
+		compressionDict := make(map[int]huffmanCode)
+		createCompressionDictionary(huffManTree, huffmanCode{}, compressionDict)
+
+		longest := uint8(0)
+		for s, code := range compressionDict {
+			lengths[s] = code.length
+			if code.length > longest {
+				longest = code.length
+			}
+		}
+		// Un único símbolo necesita al menos un bit
+		if len(compressionDict) == 1 {
+			lengths[huffManTree.Symbol] = 1
+		}
+		if longest <= maxLen {
+			return lengths
+		}
+
+		for s := range freq {
+			if freq[s] > 0 {
+				freq[s] = (freq[s] + 1) / 2
+			}
+			lengths[s] = 0
+		}
+	}
+}
+
+// canonicalCodes asigna los códigos canónicos: los símbolos se ordenan por
+// longitud y luego por valor, y cada código es el anterior + 1.
+func canonicalCodes(lengths []uint8) []huffmanCode {
+	codes := make([]huffmanCode, len(lengths))
+	maxLen := uint8(0)
+	for _, l := range lengths {
+		if l > maxLen {
+			maxLen = l
+		}
+	}
+	code := uint64(0)
+	for l := uint8(1); l <= maxLen; l++ {
+		for s := range lengths {
+			if lengths[s] == l {
+				codes[s] = huffmanCode{bits: code, length: l}
+				code++
+			}
+		}
+		code <<= 1
+	}
+	return codes
+}
+
+// writeCodeLengths empaqueta las 256 longitudes en nibbles (caben en 4 bits
+// porque huffmanMaxCodeLen = 15). Un nibble 0 inicia una racha de ceros cuya
+// longitud-1 ocupa los dos nibbles siguientes.
+func writeCodeLengths(lengths []uint8) []byte {
+	var nibbles []byte
+	for i := 0; i < len(lengths); {
+		if lengths[i] != 0 {
+			nibbles = append(nibbles, lengths[i])
+			i++
+			continue
+		}
+		run := 1
+		for i+run < len(lengths) && lengths[i+run] == 0 && run < 256 {
+			run++
+		}
+		nibbles = append(nibbles, 0, byte(run-1)>>4, byte(run-1)&0x0f)
+		i += run
+	}
+
+	out := make([]byte, (len(nibbles)+1)/2)
+	for j, n := range nibbles {
+		out[j/2] |= n << (4 * uint(1-j%2))
+	}
+	return out
+}
+
+// readCodeLengths es la inversa de writeCodeLengths. Devuelve también los
+// bytes consumidos, y un error si las longitudes no forman un código prefijo.
+func readCodeLengths(data []byte) ([]uint8, int, error) {
+	lengths := make([]uint8, 256)
+	j := 0
+	nibble := func() (byte, error) {
+		if j/2 >= len(data) {
+			return 0, fmt.Errorf("unexpected end of data while reading code lengths at index %d", j/2)
+		}
+		n := (data[j/2] >> (4 * uint(1-j%2))) & 0x0f
+		j++
+		return n, nil
+	}
+
+	for s := 0; s < len(lengths); {
+		l, err := nibble()
+		if err != nil {
+			return lengths, (j + 1) / 2, err
+		}
+		if l != 0 {
+			lengths[s] = l
+			s++
+			continue
+		}
+		hi, err := nibble()
+		if err != nil {
+			return lengths, (j + 1) / 2, err
+		}
+		lo, err := nibble()
+		if err != nil {
+			return lengths, (j + 1) / 2, err
+		}
+		run := int(hi<<4|lo) + 1
+		if s+run > len(lengths) {
+			return lengths, (j + 1) / 2, fmt.Errorf("invalid zero run at index %d", j/2)
+		}
+		s += run
+	}
+	// Unas longitudes sobresuscritas no forman un código prefijo y
+	// desbordarían la tabla de decodificación
+	if _, err := newInflateDecoder(lengths, true); err != nil {
+		return lengths, (j + 1) / 2, err
 	}
+	return lengths, (j + 1) / 2, nil
 }
 
+// huffmanCompress codifica data con Huffman por bloques; ver huffmanCompressBlocks.
 func huffmanCompress(data []byte) []byte {
-	heap := utils.BuildHeap(data)
-	huffManTree := buildHuffmanTree(&heap)
-	compressionDict := make(map[byte]string)
-	createCompressionDictionary(huffManTree, "", compressionDict)
+	return huffmanCompressBlocks(data, huffmanBlockSize)
+}
 
-	serializedTree := serializeTree(huffManTree)
+// Métodos de compresión. El byte del método va tras el nombre original; los
+// archivos anteriores no lo tienen y su carga Huffman empieza con 0, 1 o 2.
+const (
+	methodHuffman  byte = 'H'
+	methodLZSS     byte = 'L'
+	methodDeflate  byte = 'D'
+	methodLZW      byte = 'W'
+	methodAdaptive byte = 'A'
+	methodRange    byte = 'R'
+	methodBWT      byte = 'B'
+	methodStored   byte = 'S' // sin comprimir, cuando comprimir no reduce el tamaño
+)
 
-	var bw utils.BitWriter
+// Nombres aceptados por --comp-alg.
+var compressionMethods = map[string]byte{
+	"huff":    methodHuffman,
+	"lzss":    methodLZSS,
+	"deflate": methodDeflate,
+	"lzw":     methodLZW,
+	"ahuff":   methodAdaptive,
+	"range":   methodRange,
+	"bwt":     methodBWT,
+	"store":   methodStored,
+	"dict":    methodDict,
+}
 
-	lengthBits := fmt.Sprintf("%032b", len(data))
-	bw.WriteBits(lengthBits)
+// Formato del archivo comprimido: "kryp" (contenedor propio), "gzip" (RFC 1952,
+// solo con deflate) o "z" (compress(1), solo con lzw). main lo ajusta con --format.
+var compressFormat = "kryp"
 
-    for _, b := range data {
-        bw.WriteBits(compressionDict[b])
-    }
+// compressPayload comprime data con el método indicado.
+func compressPayload(data []byte, method byte) ([]byte, error) {
+	switch method {
+	case methodHuffman:
+		return huffmanCompress(data), nil
+	case methodLZSS:
+		return lzssCompress(data, lzssConfig)
+	case methodDeflate:
+		return deflateCompress(data, lzssConfig), nil
+	case methodLZW:
+		return lzwCompress(data, lzwMaxBits)
+	case methodAdaptive:
+		return adaptiveHuffmanCompress(data)
+	case methodRange:
+		return rangeCompress(data, rangeModel, lzssConfig)
+	case methodBWT:
+		return bwtCompress(data, bwtBlockSize, bwtEntropy)
+	case methodStored:
+		return append([]byte(nil), data...), nil
+	case methodDict:
+		return dictCompress(data, sharedDict)
+	case methodDelta:
+		return deltaCompress(data, deltaRef)
+	}
+	return nil, fmt.Errorf("método de compresión desconocido: %q", method)
+}
 
-    compressed := bw.Finalize()
-	compressed = append(serializedTree, compressed...)
+// compressOrStore comprime data con method y, si la carga no resulta menor
+// que data (datos ya comprimidos, archivos muy pequeños), la guarda tal cual.
+// Devuelve la carga y el método con que quedó.
+func compressOrStore(data []byte, method byte) ([]byte, byte, error) {
+	payload, err := compressPayload(data, method)
+	if err != nil {
+		return nil, method, err
+	}
+	if len(payload) >= len(data) && method != methodStored {
+		return append([]byte(nil), data...), methodStored, nil
+	}
+	return payload, method, nil
+}
 
-	return compressed
+// decompressPayload invierte compressPayload.
+func decompressPayload(payload []byte, method byte) ([]byte, error) {
+	switch method {
+	case methodHuffman:
+		return huffmanDecode(payload)
+	case methodLZSS:
+		return lzssDecompress(payload)
+	case methodDeflate:
+		out, _, err := inflate(payload)
+		return out, err
+	case methodLZW:
+		return lzwDecompress(payload)
+	case methodAdaptive:
+		return adaptiveHuffmanDecompress(payload)
+	case methodRange:
+		return rangeDecompress(payload)
+	case methodBWT:
+		return bwtDecompress(payload)
+	case methodStored:
+		return payload, nil
+	case methodDelta:
+		return deltaDecompress(payload, deltaRef)
+	case methodBlocked:
+		return decompressBlocks(payload)
+	}
+	return nil, fmt.Errorf("método de compresión desconocido: %q", method)
 }
 
-// PackWithMeta agrega un encabezado simple con magic + longitud de nombre + nombre original
-// Formato: "KRYP" (4 bytes) | nameLen uint16 BE (2 bytes) | name bytes | payload...
-func PackWithMeta(data []byte, origName string) []byte {
-	payload := huffmanCompress(data)
-	out := make([]byte, 0, 4+2+len(origName)+len(payload))
-	out = append(out, []byte("KRYP")...)
+// PackWithMeta agrega un encabezado simple con magic + longitud de nombre + nombre original + método
+// Formato: "KRYC" (4 bytes) | nameLen uint16 BE (2 bytes) | name bytes | method|methodChecked (1 byte) |
+// CRC32C del encabezado (4 bytes) | payload... | CRC32C del payload (4 bytes) | SHA-256 del original (32 bytes)
+// Los archivos mayores que parallelBlockSize se comprimen por bloques en paralelo.
+// Si la compresión no reduce el tamaño, la carga se guarda tal cual con methodStored.
+// Con methodDict se escribe el contenedor de packDict.
+func PackWithMeta(data []byte, origName string, method byte) ([]byte, error) {
+	var payload []byte
+	var err error
+	if method == methodDict {
+		packed, err := packDict(data, origName, sharedDict)
+		if err != nil || len(packed) < len(packHeader(origName, methodStored))+len(data)+containerTrailerLen {
+			return packed, err
+		}
+		method = methodStored
+	}
+	blockSize := parallelBlockSize
+	if method == methodBWT {
+		blockSize = bwtBlockSize
+	}
+	// Un delta se codifica entero: cada bloque tendría que indexar toda la referencia
+	if len(data) > blockSize && method != methodStored && method != methodDelta {
+		payload, err = compressBlocks(data, method, blockSize, parallelWorkers)
+		method = methodBlocked
+		if err == nil && len(payload) >= len(data) {
+			payload, method = data, methodStored
+		}
+	} else {
+		payload, method, err = compressOrStore(data, method)
+	}
+	if err != nil {
+		return nil, err
+	}
+	out := append(packHeader(origName, method), payload...)
+	digest := sha256.Sum256(data)
+	return append(out, containerTrailer(crc32.Checksum(payload, crc32c), digest[:])...), nil
+}
+
+// packHeader devuelve el encabezado de PackWithMeta con su CRC32C, para quien
+// escribe la carga como flujo.
+func packHeader(origName string, method byte) []byte {
+	out := make([]byte, 0, 4+2+len(origName)+1+4)
+	out = append(out, []byte(checkedMagic)...)
 	nameBytes := []byte(origName)
 	lenb := make([]byte, 2)
 	binary.BigEndian.PutUint16(lenb, uint16(len(nameBytes)))
 	out = append(out, lenb...)
 	out = append(out, nameBytes...)
-	out = append(out, payload...)
+	out = append(out, method|methodChecked)
+	return binary.BigEndian.AppendUint32(out, crc32.Checksum(out, crc32c))
+}
+
+// UnpackWithMeta extrae el nombre original y el método si el encabezado existe.
+// Si no, devuelve "", methodHuffman y el mismo packed. No comprueba las sumas
+// de verificación; para eso está decompressContainer.
+func UnpackWithMeta(packed []byte) (string, byte, []byte) {
+	name, method, headerLen, checked, err := parseContainerHeader(packed)
+	if err != nil {
+		return "", methodHuffman, packed
+	}
+	payload := packed[headerLen:]
+	if checked && len(payload) >= containerTrailerLen {
+		payload = payload[:len(payload)-containerTrailerLen]
+	}
+	return name, method, payload
+}
+
+func huffmanDecompress(packed []byte) []byte {
+	out, err := huffmanDecode(packed)
+	if err != nil {
+		fmt.Println("Error:", err)
+	}
 	return out
 }
 
-// UnpackWithMeta extrae el nombre original si el encabezado existe. Si no, devuelve "" y el mismo packed.
-func UnpackWithMeta(packed []byte) (string, []byte) {
-	if len(packed) >= 6 && string(packed[:4]) == "KRYP" {
-		nameLen := int(binary.BigEndian.Uint16(packed[4:6]))
-		if len(packed) < 6+nameLen {
-			return "", packed // malformed
+// huffmanDecode decodifica una carga Huffman en cualquiera de sus formatos:
+// por bloques, con una tabla canónica o con el árbol serializado original.
+func huffmanDecode(packed []byte) ([]byte, error) {
+	if len(packed) > 0 && packed[0] == huffmanBlocks {
+		return huffmanDecompressBlocks(packed)
+	}
+
+	dict, lenMessage, body, err := parseHuffmanHeader(packed)
+	if err != nil {
+		return nil, err
+	}
+
+	// Árbol de una sola hoja: el símbolo tiene código vacío y no se escribieron bits
+	if val, ok := dict[huffmanCode{}]; ok {
+		if lenMessage > huffmanMaxSingleLeaf {
+			return nil, fmt.Errorf("longitud %d de un árbol de una hoja fuera de rango (datos corruptos)", lenMessage)
 		}
-		name := string(packed[6 : 6+nameLen])
-		payload := packed[6+nameLen:]
-		return name, payload
+		return bytes.Repeat([]byte{val}, int(lenMessage)), nil
 	}
-	return "", packed
+
+	return decodeSymbolsTable(buildHuffmanTable(dict), body, int(lenMessage))
 }
 
-func huffmanDecompress(packed []byte) []byte {
-    var out []byte
-    var current string
+// parseHuffmanHeader lee la tabla (canónica o árbol serializado) y la longitud
+// del mensaje, y devuelve el resto de la carga.
+func parseHuffmanHeader(packed []byte) (map[huffmanCode]byte, uint32, []byte, error) {
+	var dict map[huffmanCode]byte
 	i := 0
-	dict, i := DeserializeToDict(packed)
+	if len(packed) > 0 && packed[0] == huffmanCanonical {
+		lengths, n, err := readCodeLengths(packed[1:])
+		if err != nil {
+			return nil, 0, nil, fmt.Errorf("longitudes de código inválidas: %v", err)
+		}
+		dict = make(map[huffmanCode]byte)
+		for s, code := range canonicalCodes(lengths) {
+			if code.length > 0 {
+				dict[code] = byte(s)
+			}
+		}
+		i = 1 + n
+	} else {
+		dict, i = DeserializeToDict(packed)
+	}
 	if dict == nil {
-		fmt.Println("Error: fallo al deserializar el árbol (datos corruptos)")
-		return out
+		return nil, 0, nil, fmt.Errorf("fallo al deserializar el árbol (datos corruptos)")
 	}
 	if i >= len(packed) {
-		fmt.Println("Error: no queda data tras el árbol")
-		return out
+		return nil, 0, nil, fmt.Errorf("no queda data tras el árbol")
 	}
 	compressedData := packed[i:]
 
 	if len(compressedData) < 4 {
-		fmt.Println("Error: espacio insuficiente para la longitud del mensaje")
-		return out
-	}
-	lenMessage := binary.BigEndian.Uint32(compressedData[:4])
-	symbolsRead := 0
-	fmt.Println("Length of message:", lenMessage)
-
-    for _, b := range compressedData[4:] {
-        for i := 7; i >= 0; i-- {
-            bit := (b >> i) & 1
-            if bit == 1 {
-                current += "1"
-            } else {
-                current += "0"
-            }
-
-            if val, ok := dict[current]; ok {
-                out = append(out, val)
-                current = ""
-				symbolsRead++
-            }
-
-			if symbolsRead >= int(lenMessage) {
-				return out
-			}
-        }
-    }
-
-    return out
+		return nil, 0, nil, fmt.Errorf("espacio insuficiente para la longitud del mensaje")
+	}
+	return dict, binary.BigEndian.Uint32(compressedData[:4]), compressedData[4:], nil
 }
 
 /*
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"kryptr/utils"
+	"math/rand"
+	"testing"
+)
+
+// testInputs devuelve las entradas usadas en las pruebas de ida y vuelta.
+func testInputs() map[string][]byte {
+	rng := rand.New(rand.NewSource(2004))
+	random := make([]byte, 64*1024)
+	rng.Read(random)
+
+	all := make([]byte, 256)
+	for i := range all {
+		all[i] = byte(i)
+	}
+
+	skewed := make([]byte, 32*1024)
+	for i := range skewed {
+		if rng.Intn(16) == 0 {
+			skewed[i] = byte(rng.Intn(256))
+		} else {
+			skewed[i] = 'a' + byte(rng.Intn(3))
+		}
+	}
+
+	return map[string][]byte{
+		"vacío":     {},
+		"un byte":   {'x'},
+		"repetido":  bytes.Repeat([]byte{'z'}, 1000),
+		"alfabeto":  all,
+		"texto":     bytes.Repeat([]byte("Proyecto Final de Sistemas Operativos. "), 200),
+		"sesgado":   skewed,
+		"aleatorio": random,
+	}
+}
+
+// logInput genera texto pseudoaleatorio con palabras repetidas, parecido a un log.
+func logInput(size int) []byte {
+	rng := rand.New(rand.NewSource(2004))
+	words := []string{"INFO", "WARN", "ERROR", "kryptr", "archivo", "comprimido",
+		"directorio", "bytes", "syscall", "getdents64", "huffman", "0x7f3a", "\n"}
+	var buf bytes.Buffer
+	for buf.Len() < size {
+		buf.WriteString(words[rng.Intn(len(words))])
+		buf.WriteByte(' ')
+	}
+	return buf.Bytes()[:size]
+}
+
+// huffmanCompressSingle codifica data con una sola tabla canónica y la longitud
+// en 32 bits, el formato anterior a los bloques, para comparar con él el
+// formato por bloques en las pruebas y en las de rendimiento.
+func huffmanCompressSingle(data []byte) []byte {
+	freq := make([]int, 256)
+	for _, b := range data {
+		freq[b]++
+	}
+	lengths := huffmanCodeLengths(freq, huffmanMaxCodeLen)
+	compressionDict := canonicalCodes(lengths)
+
+	header := append([]byte{huffmanCanonical}, writeCodeLengths(lengths)...)
+
+	var bw utils.BitWriter
+
+	bw.WriteBits(uint64(len(data)), 32)
+
+	for _, b := range data {
+		code := compressionDict[b]
+		bw.WriteBits(code.bits, code.length)
+	}
+
+	return append(header, bw.Finalize()...)
+}
+
+// TestHuffmanSingleLeaf decodifica el árbol de una hoja del formato anterior,
+// que no lleva bits, y rechaza una longitud que reservaría 4 GiB.
+func TestHuffmanSingleLeaf(t *testing.T) {
+	got, err := huffmanDecode(mustHex("017a000003e8"))
+	if err != nil || !bytes.Equal(got, bytes.Repeat([]byte{'z'}, 1000)) {
+		t.Fatalf("una hoja: %d bytes, %v", len(got), err)
+	}
+	if _, err := huffmanDecode(mustHex("017affffffff")); err == nil {
+		t.Fatal("se aceptó una longitud de 4 GiB sin datos")
+	}
+}
+
+func TestHuffmanRoundTrip(t *testing.T) {
+	for name, data := range testInputs() {
+		if got := huffmanDecompress(huffmanCompress(data)); !bytes.Equal(got, data) {
+			t.Fatalf("entrada %q no coincide", name)
+		}
+	}
+}
+
+// TestHuffmanMaxCodeLen usa frecuencias de Fibonacci, que producen el árbol
+// más profundo posible, y comprueba que las longitudes quedan acotadas.
+func TestHuffmanMaxCodeLen(t *testing.T) {
+	var data []byte
+	a, b := 1, 1
+	for s := 0; s < 24; s++ {
+		data = append(data, bytes.Repeat([]byte{byte('A' + s)}, a)...)
+		a, b = b, a+b
+	}
+	var freq [256]int
+	for _, c := range data {
+		freq[c]++
+	}
+	for s, l := range huffmanCodeLengths(freq[:], huffmanMaxCodeLen) {
+		if l > huffmanMaxCodeLen {
+			t.Fatalf("símbolo %d con longitud %d", s, l)
+		}
+	}
+	if got := huffmanDecompress(huffmanCompress(data)); !bytes.Equal(got, data) {
+		t.Fatal("la ida y vuelta no coincide")
+	}
+}
+
+func TestPackRoundTrip(t *testing.T) {
+	data := bytes.Repeat([]byte("contenido de prueba, "), 20)
+	for alg, method := range compressionMethods {
+		if method == methodDict {
+			continue
+		}
+		packed, err := PackWithMeta(data, "prueba.txt", method)
+		if err != nil {
+			t.Fatal(err)
+		}
+		name, m, payload := UnpackWithMeta(packed)
+		if name != "prueba.txt" || m != method {
+			t.Fatalf("%s: encabezado (%q, %q), esperado (%q, %q)", alg, name, m, "prueba.txt", method)
+		}
+		got, err := decompressPayload(payload, m)
+		if err != nil {
+			t.Fatalf("%s: %v", alg, err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Fatalf("%s: descomprimido %q, esperado %q", alg, got, data)
+		}
+	}
+
+	// Contenedor sin byte de método, tal como lo escribían las versiones anteriores
+	legacy := append([]byte("KRYP\x00\x01a"), mustHex("00016100016200017200016301640000000b59cf58")...)
+	if name, m, _ := UnpackWithMeta(legacy); name != "a" || m != methodHuffman {
+		t.Fatalf("contenedor anterior: (%q, %q)", name, m)
+	}
+}
@@ -0,0 +1,498 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"kryptr/utils"
+	"math/bits"
+)
+
+// Tablas de RFC 1951, sección 3.2.5.
+var (
+	deflateLengthBase  = [29]uint16{3, 4, 5, 6, 7, 8, 9, 10, 11, 13, 15, 17, 19, 23, 27, 31, 35, 43, 51, 59, 67, 83, 99, 115, 131, 163, 195, 227, 258}
+	deflateLengthExtra = [29]uint8{0, 0, 0, 0, 0, 0, 0, 0, 1, 1, 1, 1, 2, 2, 2, 2, 3, 3, 3, 3, 4, 4, 4, 4, 5, 5, 5, 5, 0}
+	deflateDistBase    = [30]uint16{1, 2, 3, 4, 5, 7, 9, 13, 17, 25, 33, 49, 65, 97, 129, 193, 257, 385, 513, 769, 1025, 1537, 2049, 3073, 4097, 6145, 8193, 12289, 16385, 24577}
+	deflateDistExtra   = [30]uint8{0, 0, 0, 0, 1, 1, 2, 2, 3, 3, 4, 4, 5, 5, 6, 6, 7, 7, 8, 8, 9, 9, 10, 10, 11, 11, 12, 12, 13, 13}
+	// Orden en que se escriben las longitudes del código de longitudes
+	deflateCodeLengthOrder = [19]uint8{16, 17, 18, 0, 8, 7, 9, 6, 10, 5, 11, 4, 12, 3, 13, 2, 14, 1, 15}
+)
+
+const (
+	deflateWindow       = 1 << 15
+	deflateMaxMatch     = 258
+	deflateEndOfBlock   = 256
+	deflateBlockTokens  = 1 << 15 // tokens por bloque dinámico
+	deflateCodeLenLimit = 7       // longitud máxima del código de longitudes
+)
+
+// deflateToken es un literal (length == 0) o una coincidencia (length, dist).
+type deflateToken struct {
+	length uint16
+	dist   uint16
+	lit    byte
+}
+
+// deflateSymbol busca en base el último índice cuyo valor no supera v.
+func deflateSymbol(base []uint16, v int) int {
+	i := len(base) - 1
+	for int(base[i]) > v {
+		i--
+	}
+	return i
+}
+
+// writeCode escribe un código Huffman: DEFLATE empaqueta los bits desde el
+// menos significativo, pero los códigos van desde su bit más significativo.
+func writeCode(w *utils.LSBBitWriter, c huffmanCode) {
+	w.WriteBits(uint64(bits.Reverse16(uint16(c.bits))>>(16-c.length)), c.length)
+}
+
+// deflateCompress produce un flujo RFC 1951 con bloques Huffman dinámicos.
+// Las coincidencias vienen de lzParse con la ventana y longitud máximas de DEFLATE.
+func deflateCompress(data []byte, p lzssParams) []byte {
+	if p.window > deflateWindow {
+		p.window = deflateWindow
+	}
+	if p.lookahead > deflateMaxMatch {
+		p.lookahead = deflateMaxMatch
+	}
+	p, err := p.validate()
+	if err != nil {
+		p = lzssParams{window: deflateWindow, lookahead: deflateMaxMatch, maxChain: p.maxChain}
+	}
+
+	var tokens []deflateToken
+	lzParse(data, p, func(b byte) {
+		tokens = append(tokens, deflateToken{lit: b})
+	}, func(length, dist int) {
+		tokens = append(tokens, deflateToken{length: uint16(length), dist: uint16(dist)})
+	})
+
+	var w utils.LSBBitWriter
+	for start := 0; ; start += deflateBlockTokens {
+		end := start + deflateBlockTokens
+		if end > len(tokens) {
+			end = len(tokens)
+		}
+		final := end == len(tokens)
+		deflateWriteBlock(&w, tokens[start:end], final)
+		if final {
+			break
+		}
+	}
+	return w.Finalize()
+}
+
+// deflateWriteBlock escribe un bloque dinámico (BTYPE = 2) con sus propias tablas.
+func deflateWriteBlock(w *utils.LSBBitWriter, tokens []deflateToken, final bool) {
+	litFreq := make([]int, 286)
+	distFreq := make([]int, 30)
+	for _, t := range tokens {
+		if t.length == 0 {
+			litFreq[t.lit]++
+		} else {
+			litFreq[257+deflateSymbol(deflateLengthBase[:], int(t.length))]++
+			distFreq[deflateSymbol(deflateDistBase[:], int(t.dist))]++
+		}
+	}
+	litFreq[deflateEndOfBlock]++
+
+	litLen := huffmanCodeLengths(litFreq, huffmanMaxCodeLen)
+	distLen := huffmanCodeLengths(distFreq, huffmanMaxCodeLen)
+	litCodes := canonicalCodes(litLen)
+	distCodes := canonicalCodes(distLen)
+
+	hlit := 286
+	for hlit > 257 && litLen[hlit-1] == 0 {
+		hlit--
+	}
+	hdist := 30
+	for hdist > 1 && distLen[hdist-1] == 0 {
+		hdist--
+	}
+
+	// Longitudes de ambos alfabetos codificadas con rachas (símbolos 16, 17 y 18)
+	type clSymbol struct {
+		sym   uint8
+		extra uint8
+	}
+	all := append(append([]uint8(nil), litLen[:hlit]...), distLen[:hdist]...)
+	var cl []clSymbol
+	clFreq := make([]int, 19)
+	emit := func(sym, extra uint8) {
+		cl = append(cl, clSymbol{sym, extra})
+		clFreq[sym]++
+	}
+	for i := 0; i < len(all); {
+		l := all[i]
+		run := 1
+		for i+run < len(all) && all[i+run] == l {
+			run++
+		}
+		switch {
+		case l == 0 && run >= 11:
+			if run > 138 {
+				run = 138
+			}
+			emit(18, uint8(run-11))
+			i += run
+		case l == 0 && run >= 3:
+			emit(17, uint8(run-3))
+			i += run
+		case l != 0 && run >= 4:
+			n := run - 1
+			if n > 6 {
+				n = 6
+			}
+			emit(l, 0)
+			emit(16, uint8(n-3))
+			i += 1 + n
+		default:
+			emit(l, 0)
+			i++
+		}
+	}
+	clLen := huffmanCodeLengths(clFreq, deflateCodeLenLimit)
+	clCodes := canonicalCodes(clLen)
+	hclen := 19
+	for hclen > 4 && clLen[deflateCodeLengthOrder[hclen-1]] == 0 {
+		hclen--
+	}
+
+	if final {
+		w.WriteBits(1, 1)
+	} else {
+		w.WriteBits(0, 1)
+	}
+	w.WriteBits(2, 2)
+	w.WriteBits(uint64(hlit-257), 5)
+	w.WriteBits(uint64(hdist-1), 5)
+	w.WriteBits(uint64(hclen-4), 4)
+	for i := 0; i < hclen; i++ {
+		w.WriteBits(uint64(clLen[deflateCodeLengthOrder[i]]), 3)
+	}
+	for _, c := range cl {
+		writeCode(w, clCodes[c.sym])
+		switch c.sym {
+		case 16:
+			w.WriteBits(uint64(c.extra), 2)
+		case 17:
+			w.WriteBits(uint64(c.extra), 3)
+		case 18:
+			w.WriteBits(uint64(c.extra), 7)
+		}
+	}
+
+	for _, t := range tokens {
+		if t.length == 0 {
+			writeCode(w, litCodes[t.lit])
+			continue
+		}
+		li := deflateSymbol(deflateLengthBase[:], int(t.length))
+		writeCode(w, litCodes[257+li])
+		w.WriteBits(uint64(t.length-deflateLengthBase[li]), deflateLengthExtra[li])
+		di := deflateSymbol(deflateDistBase[:], int(t.dist))
+		writeCode(w, distCodes[di])
+		w.WriteBits(uint64(t.dist-deflateDistBase[di]), deflateDistExtra[di])
+	}
+	writeCode(w, litCodes[deflateEndOfBlock])
+}
+
+// inflateDecoder decodifica un código canónico con la tabla de
+// huffmantable.go. DEFLATE guarda cada código desde su bit más significativo
+// en un flujo que se lee desde el menos significativo, así que los bits que
+// se miran se invierten antes de buscarlos en la tabla.
+type inflateDecoder struct {
+	table *huffmanTable
+}
+
+// newInflateDecoder valida las longitudes. Un código incompleto solo se admite
+// si tiene a lo sumo un símbolo o si allowIncomplete es true (distancias fijas).
+func newInflateDecoder(lengths []uint8, allowIncomplete bool) (*inflateDecoder, error) {
+	var count [huffmanMaxCodeLen + 1]int
+	for _, l := range lengths {
+		count[l]++
+	}
+	left, codes := 1, 0
+	for l := 1; l <= huffmanMaxCodeLen; l++ {
+		left <<= 1
+		left -= count[l]
+		codes += count[l]
+		if left < 0 {
+			return nil, fmt.Errorf("código Huffman sobresuscrito")
+		}
+	}
+	if left > 0 && codes > 1 && !allowIncomplete {
+		return nil, fmt.Errorf("código Huffman incompleto")
+	}
+	table := make(map[huffmanCode]uint16, codes)
+	for s, c := range canonicalCodes(lengths) {
+		if c.length > 0 {
+			table[c] = uint16(s)
+		}
+	}
+	return &inflateDecoder{table: buildCodeTable(table)}, nil
+}
+
+func (d *inflateDecoder) decode(r *utils.LSBBitReader) (int, error) {
+	for t := d.table; ; {
+		e := t.entries[bits.Reverse16(uint16(r.Peek(t.bits)))>>(16-t.bits)]
+		if e.length == 0 {
+			return 0, fmt.Errorf("código Huffman inválido")
+		}
+		r.Consume(e.length)
+		if e.sub == nil {
+			return int(e.symbol), nil
+		}
+		t = e.sub
+	}
+}
+
+// inflateFixed devuelve los decodificadores del bloque de códigos fijos (BTYPE = 1).
+func inflateFixed() (*inflateDecoder, *inflateDecoder) {
+	lengths := make([]uint8, 288)
+	for s := range lengths {
+		switch {
+		case s < 144:
+			lengths[s] = 8
+		case s < 256:
+			lengths[s] = 9
+		case s < 280:
+			lengths[s] = 7
+		default:
+			lengths[s] = 8
+		}
+	}
+	lit, _ := newInflateDecoder(lengths, false)
+	dists := make([]uint8, 30)
+	for s := range dists {
+		dists[s] = 5
+	}
+	dist, _ := newInflateDecoder(dists, true)
+	return lit, dist
+}
+
+// inflateDynamic lee las tablas de un bloque dinámico (BTYPE = 2).
+func inflateDynamic(r *utils.LSBBitReader) (*inflateDecoder, *inflateDecoder, error) {
+	hlit := int(r.ReadBits(5)) + 257
+	hdist := int(r.ReadBits(5)) + 1
+	hclen := int(r.ReadBits(4)) + 4
+	if hlit > 286 || hdist > 30 {
+		return nil, nil, fmt.Errorf("demasiados códigos: %d/%d", hlit, hdist)
+	}
+
+	clLen := make([]uint8, 19)
+	for i := 0; i < hclen; i++ {
+		clLen[deflateCodeLengthOrder[i]] = uint8(r.ReadBits(3))
+	}
+	clDec, err := newInflateDecoder(clLen, false)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	lengths := make([]uint8, hlit+hdist)
+	for i := 0; i < len(lengths); {
+		sym, err := clDec.decode(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		if sym < 16 {
+			lengths[i] = uint8(sym)
+			i++
+			continue
+		}
+		var val uint8
+		var n int
+		switch sym {
+		case 16:
+			if i == 0 {
+				return nil, nil, fmt.Errorf("repetición sin longitud previa")
+			}
+			val, n = lengths[i-1], 3+int(r.ReadBits(2))
+		case 17:
+			n = 3 + int(r.ReadBits(3))
+		default:
+			n = 11 + int(r.ReadBits(7))
+		}
+		if i+n > len(lengths) {
+			return nil, nil, fmt.Errorf("demasiadas longitudes de código")
+		}
+		for ; n > 0; n-- {
+			lengths[i] = val
+			i++
+		}
+	}
+	if lengths[deflateEndOfBlock] == 0 {
+		return nil, nil, fmt.Errorf("falta el código de fin de bloque")
+	}
+
+	lit, err := newInflateDecoder(lengths[:hlit], false)
+	if err != nil {
+		return nil, nil, err
+	}
+	dist, err := newInflateDecoder(lengths[hlit:], false)
+	if err != nil {
+		return nil, nil, err
+	}
+	return lit, dist, nil
+}
+
+// inflate decodifica un flujo RFC 1951 completo. Devuelve también los bytes
+// consumidos, para poder leer lo que venga detrás (p. ej. el pie de gzip).
+func inflate(data []byte) ([]byte, int, error) {
+	r := utils.NewLSBBitReader(data)
+	var out []byte
+	for {
+		final := r.ReadBits(1)
+		var lit, dist *inflateDecoder
+		switch r.ReadBits(2) {
+		case 0:
+			r.AlignByte()
+			n := r.ReadBits(16)
+			if nn := r.ReadBits(16); n != ^nn&0xffff {
+				return out, 0, fmt.Errorf("longitud de bloque almacenado inválida")
+			}
+			for ; n > 0; n-- {
+				out = append(out, byte(r.ReadBits(8)))
+			}
+		case 1:
+			lit, dist = inflateFixed()
+		case 2:
+			var err error
+			if lit, dist, err = inflateDynamic(r); err != nil {
+				return out, 0, err
+			}
+		default:
+			return out, 0, fmt.Errorf("tipo de bloque inválido")
+		}
+
+		for lit != nil {
+			if r.Overrun() {
+				break
+			}
+			sym, err := lit.decode(r)
+			if err != nil {
+				return out, 0, err
+			}
+			if sym < 256 {
+				out = append(out, byte(sym))
+				continue
+			}
+			if sym == deflateEndOfBlock {
+				break
+			}
+			li := sym - 257
+			if li >= len(deflateLengthBase) {
+				return out, 0, fmt.Errorf("símbolo de longitud inválido: %d", sym)
+			}
+			length := int(deflateLengthBase[li]) + int(r.ReadBits(deflateLengthExtra[li]))
+			di, err := dist.decode(r)
+			if err != nil {
+				return out, 0, err
+			}
+			if di >= len(deflateDistBase) {
+				return out, 0, fmt.Errorf("símbolo de distancia inválido: %d", di)
+			}
+			d := int(deflateDistBase[di]) + int(r.ReadBits(deflateDistExtra[di]))
+			if d > len(out) {
+				return out, 0, fmt.Errorf("distancia %d fuera de la salida (%d bytes)", d, len(out))
+			}
+			for k := 0; k < length; k++ {
+				out = append(out, out[len(out)-d])
+			}
+		}
+
+		if r.Overrun() {
+			return out, 0, fmt.Errorf("flujo DEFLATE truncado")
+		}
+		if final == 1 {
+			return out, r.BytesConsumed(), nil
+		}
+	}
+}
+
+// Flags del encabezado gzip (RFC 1952, sección 2.3.1).
+const (
+	gzipFlagHCRC    = 1 << 1
+	gzipFlagExtra   = 1 << 2
+	gzipFlagName    = 1 << 3
+	gzipFlagComment = 1 << 4
+)
+
+// gzipCompress envuelve el flujo DEFLATE en un miembro gzip. MTIME queda en 0
+// para que la salida solo dependa del contenido y del nombre.
+func gzipCompress(data []byte, name string, p lzssParams) []byte {
+	out := []byte{0x1f, 0x8b, 8, 0, 0, 0, 0, 0, 0, 3}
+	if name != "" {
+		out[3] = gzipFlagName
+		out = append(out, name...)
+		out = append(out, 0)
+	}
+	out = append(out, deflateCompress(data, p)...)
+	out = binary.LittleEndian.AppendUint32(out, crc32.ChecksumIEEE(data))
+	out = binary.LittleEndian.AppendUint32(out, uint32(len(data)))
+	return out
+}
+
+// isGzip indica si data empieza con la firma de gzip.
+func isGzip(data []byte) bool {
+	return len(data) >= 2 && data[0] == 0x1f && data[1] == 0x8b
+}
+
+// gunzipData decodifica uno o más miembros gzip concatenados y devuelve el
+// nombre original del primero (FNAME), si lo tiene.
+func gunzipData(data []byte) (string, []byte, error) {
+	var name string
+	var out []byte
+	for first := true; first || len(data) > 0; first = false {
+		if len(data) < 10 || !isGzip(data) || data[2] != 8 {
+			return name, out, fmt.Errorf("encabezado gzip inválido")
+		}
+		flags := data[3]
+		pos := 10
+		if flags&gzipFlagExtra != 0 {
+			if pos+2 > len(data) {
+				return name, out, fmt.Errorf("encabezado gzip truncado")
+			}
+			pos += 2 + int(binary.LittleEndian.Uint16(data[pos:]))
+		}
+		for _, f := range []byte{gzipFlagName, gzipFlagComment} {
+			if flags&f == 0 {
+				continue
+			}
+			start := pos
+			for pos < len(data) && data[pos] != 0 {
+				pos++
+			}
+			if f == gzipFlagName && first {
+				name = string(data[start:pos])
+			}
+			pos++
+		}
+		if flags&gzipFlagHCRC != 0 {
+			pos += 2
+		}
+		if pos > len(data) {
+			return name, out, fmt.Errorf("encabezado gzip truncado")
+		}
+
+		member, n, err := inflate(data[pos:])
+		if err != nil {
+			return name, out, err
+		}
+		pos += n
+		if pos+8 > len(data) {
+			return name, out, fmt.Errorf("falta el pie gzip")
+		}
+		if crc := binary.LittleEndian.Uint32(data[pos:]); crc != crc32.ChecksumIEEE(member) {
+			return name, out, fmt.Errorf("CRC32 gzip no coincide")
+		}
+		if size := binary.LittleEndian.Uint32(data[pos+4:]); size != uint32(len(member)) {
+			return name, out, fmt.Errorf("tamaño gzip no coincide")
+		}
+		out = append(out, member...)
+		data = data[pos+8:]
+	}
+	return name, out, nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"testing"
+)
+
+func TestDeflateRoundTrip(t *testing.T) {
+	for name, data := range testInputs() {
+		got, _, err := inflate(deflateCompress(data, lzssConfig))
+		if err != nil {
+			t.Fatalf("entrada %q: %v", name, err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Fatalf("entrada %q no coincide", name)
+		}
+	}
+}
+
+// TestDeflateStdlib comprueba en ambos sentidos contra la biblioteca estándar:
+// compress/flate lee nuestra salida e inflate lee bloques almacenados, fijos y
+// dinámicos producidos por compress/flate.
+func TestDeflateStdlib(t *testing.T) {
+	inputs := testInputs()
+	inputs["largo"] = logInput(1 << 20)
+	for name, data := range inputs {
+		got, err := io.ReadAll(flate.NewReader(bytes.NewReader(deflateCompress(data, lzssConfig))))
+		if err != nil {
+			t.Fatalf("entrada %q: compress/flate: %v", name, err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Fatalf("entrada %q: compress/flate no reproduce la entrada", name)
+		}
+
+		for _, level := range []int{flate.HuffmanOnly, flate.NoCompression, flate.BestSpeed, flate.DefaultCompression, flate.BestCompression} {
+			var buf bytes.Buffer
+			fw, _ := flate.NewWriter(&buf, level)
+			fw.Write(data)
+			fw.Close()
+			got, _, err := inflate(buf.Bytes())
+			if err != nil {
+				t.Fatalf("entrada %q, nivel %d: %v", name, level, err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Fatalf("entrada %q, nivel %d: inflate no reproduce la entrada", name, level)
+			}
+		}
+	}
+}
+
+func TestGzipStdlib(t *testing.T) {
+	data := logInput(100 * 1024)
+	zr, err := gzip.NewReader(bytes.NewReader(gzipCompress(data, "registro.log", lzssConfig)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) || zr.Name != "registro.log" {
+		t.Fatalf("compress/gzip leyó %q con %d bytes", zr.Name, len(got))
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Name = "otro.txt"
+	zw.Comment = "comentario"
+	zw.Write(data)
+	zw.Close()
+	name, got, err := gunzipData(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) || name != "otro.txt" {
+		t.Fatalf("gunzipData leyó %q con %d bytes", name, len(got))
+	}
+
+	// El nombre del miembro no puede sacar la salida de su directorio
+	for name, want := range map[string]string{"../../x.txt": "x.txt", "/etc/passwd": "passwd", "..": "", ".": "", "": "", "a/": "a"} {
+		if got := safeOrigName(name); got != want {
+			t.Fatalf("nombre %q: se usaría %q, esperado %q", name, got, want)
+		}
+	}
+}
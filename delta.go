@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+)
+
+// Compresión delta (--delta-from): el archivo se describe como instrucciones
+// de copia de la versión de referencia e inserción de bytes nuevos, al estilo
+// de VCDIFF, y las instrucciones se codifican con el codificador de rango.
+// Formato de la carga: longitud original uint64 BE | longitud de la
+// referencia uint64 BE | SHA-256 de la referencia | flujo del codificador de rango.
+const methodDelta byte = 'X'
+
+// Las coincidencias con la referencia se buscan con un índice de los bloques
+// de deltaMinMatch bytes que empiezan cada deltaStep bytes; cualquier tramo
+// común de deltaMinMatch+deltaStep-1 bytes se encuentra.
+const (
+	deltaMinMatch = 16
+	deltaStep     = 8
+	deltaMaxSize  = 1 << 30 // límite de la referencia y de cada instrucción
+)
+
+// Referencia usada por el método delta; main la carga con --delta-from.
+var deltaRef []byte
+
+// deltaIndex ubica bloques de la referencia por su hash.
+type deltaIndex struct {
+	ref   []byte
+	table []int32
+	shift uint
+}
+
+func newDeltaIndex(ref []byte) *deltaIndex {
+	bits := uint(10)
+	for bits < 24 && 1<<bits < 2*len(ref)/deltaStep {
+		bits++
+	}
+	x := &deltaIndex{ref: ref, table: make([]int32, 1<<bits), shift: 64 - bits}
+	for i := range x.table {
+		x.table[i] = -1
+	}
+	for i := 0; i+deltaMinMatch <= len(ref); i += deltaStep {
+		x.table[x.hash(ref[i:])] = int32(i)
+	}
+	return x
+}
+
+func (x *deltaIndex) hash(b []byte) uint64 {
+	v := binary.LittleEndian.Uint64(b) ^ binary.LittleEndian.Uint64(b[8:])*0xff51afd7ed558ccd
+	return (v * 0x9e3779b97f4a7c15) >> x.shift
+}
+
+// matchLen devuelve cuántos bytes coinciden desde ref[addr] y target[j].
+func (x *deltaIndex) matchLen(addr int, target []byte, j int) int {
+	if addr < 0 || addr >= len(x.ref) {
+		return 0
+	}
+	n := 0
+	for addr+n < len(x.ref) && j+n < len(target) && n < deltaMaxSize && x.ref[addr+n] == target[j+n] {
+		n++
+	}
+	return n
+}
+
+// deltaInstructions recorre target y llama a add con cada tramo sin
+// coincidencia y a copyRef con cada tramo copiado de la referencia. Primero se
+// prueba la copia alineada con la anterior, que es lo habitual tras un
+// cambio pequeño, y después el índice.
+func deltaInstructions(ref, target []byte, add func(b []byte), copyRef func(addr, length int)) {
+	x := newDeltaIndex(ref)
+	pending, offset := 0, 0
+	for j := 0; j+deltaMinMatch <= len(target); {
+		addr, length := j+offset, x.matchLen(j+offset, target, j)
+		if length < deltaMinMatch {
+			if cand := x.table[x.hash(target[j:])]; cand >= 0 {
+				if n := x.matchLen(int(cand), target, j); n > length {
+					addr, length = int(cand), n
+				}
+			}
+		}
+		if length < deltaMinMatch {
+			j++
+			continue
+		}
+		// Extender hacia atrás sobre los bytes pendientes
+		for addr > 0 && j > pending && length < deltaMaxSize && ref[addr-1] == target[j-1] {
+			addr, j, length = addr-1, j-1, length+1
+		}
+		for ; pending < j; pending += deltaMaxSize {
+			add(target[pending:min(j, pending+deltaMaxSize)])
+		}
+		copyRef(addr, length)
+		j += length
+		pending, offset = j, addr+length-j
+	}
+	for ; pending < len(target); pending += deltaMaxSize {
+		add(target[pending:min(len(target), pending+deltaMaxSize)])
+	}
+}
+
+// deltaModel son las probabilidades compartidas por el codificador y el
+// decodificador. Los bytes insertados usan como contexto el byte de la
+// referencia en la posición alineada con la última copia: en binarios
+// recompilados los cambios suelen ser direcciones desplazadas.
+type deltaModel struct {
+	isCopy         []rangeProb // [tipo de la instrucción anterior]
+	lit            []rangeProb // [byte alineado de la referencia][árbol]
+	addLen         *rangeNumber
+	copyLen, addrs *rangeNumber
+}
+
+func newDeltaModel() *deltaModel {
+	return &deltaModel{newProbs(2), newProbs(256 * 256), newRangeNumber(), newRangeNumber(), newRangeNumber()}
+}
+
+// aligned devuelve el byte de la referencia alineado con la posición j.
+func aligned(ref []byte, j, offset int) int {
+	if p := j + offset; p >= 0 && p < len(ref) {
+		return int(ref[p])
+	}
+	return 0
+}
+
+// expectedAddr es la dirección de la referencia que continuaría la última
+// copia; las direcciones se codifican como diferencia con ella.
+func expectedAddr(ref []byte, j, offset int) int {
+	return min(max(j+offset, 0), len(ref))
+}
+
+func zigzag(v int) uint32   { return uint32(v<<1 ^ v>>63) }
+func unzigzag(z uint32) int { return int(z>>1) ^ -int(z&1) }
+
+func deltaCompress(target, ref []byte) ([]byte, error) {
+	if ref == nil {
+		return nil, fmt.Errorf("el método delta requiere una referencia (--delta-from)")
+	}
+	if len(ref) > deltaMaxSize {
+		return nil, fmt.Errorf("referencia demasiado grande: %d bytes (máximo %d)", len(ref), deltaMaxSize)
+	}
+	sum := sha256.Sum256(ref)
+	header := binary.BigEndian.AppendUint64(nil, uint64(len(target)))
+	header = binary.BigEndian.AppendUint64(header, uint64(len(ref)))
+	header = append(header, sum[:]...)
+
+	e := newRangeEncoder()
+	m := newDeltaModel()
+	j, offset, state := 0, 0, 0
+	deltaInstructions(ref, target, func(b []byte) {
+		e.encodeBit(&m.isCopy[state], 0)
+		m.addLen.encode(e, uint32(len(b)-1))
+		for _, c := range b {
+			e.encodeTree(m.lit[aligned(ref, j, offset)<<8:], 8, uint32(c))
+			j++
+		}
+		state = 0
+	}, func(addr, length int) {
+		e.encodeBit(&m.isCopy[state], 1)
+		m.copyLen.encode(e, uint32(length-deltaMinMatch))
+		m.addrs.encode(e, zigzag(addr-expectedAddr(ref, j, offset)))
+		j += length
+		offset, state = addr+length-j, 1
+	})
+	return append(header, e.finish()...), nil
+}
+
+func deltaDecompress(payload, ref []byte) ([]byte, error) {
+	if len(payload) < 16+sha256.Size {
+		return nil, fmt.Errorf("encabezado delta incompleto")
+	}
+	size := binary.BigEndian.Uint64(payload)
+	refLen := binary.BigEndian.Uint64(payload[8:])
+	if ref == nil {
+		return nil, fmt.Errorf("es un delta de una referencia de %d bytes: indícala con --delta-from o usa kryptr patch", refLen)
+	}
+	if sum := sha256.Sum256(ref); refLen != uint64(len(ref)) || !bytes.Equal(sum[:], payload[16:16+sha256.Size]) {
+		return nil, fmt.Errorf("la referencia no es la usada al crear el delta (%d bytes, SHA-256 %x…)", refLen, payload[16:24])
+	}
+	d, err := newRangeDecoder(payload[16+sha256.Size:])
+	if err != nil {
+		return nil, err
+	}
+
+	m := newDeltaModel()
+	out := make([]byte, 0, min(size, uint64(len(payload))*64+uint64(len(ref))))
+	offset, state := 0, 0
+	for uint64(len(out)) < size && !d.overrun() {
+		if d.decodeBit(&m.isCopy[state]) == 0 {
+			n := uint64(m.addLen.decode(d)) + 1
+			if uint64(len(out))+n > size {
+				return out, fmt.Errorf("la inserción excede la longitud original")
+			}
+			for ; n > 0 && !d.overrun(); n-- {
+				out = append(out, byte(d.decodeTree(m.lit[aligned(ref, len(out), offset)<<8:], 8)))
+			}
+			state = 0
+			continue
+		}
+		length := int(m.copyLen.decode(d)) + deltaMinMatch
+		addr := expectedAddr(ref, len(out), offset) + unzigzag(m.addrs.decode(d))
+		if d.overrun() {
+			break
+		}
+		if addr < 0 || addr+length > len(ref) || uint64(len(out)+length) > size {
+			return out, fmt.Errorf("copia fuera de la referencia: %d bytes desde %d", length, addr)
+		}
+		out = append(out, ref[addr:addr+length]...)
+		offset, state = addr+length-len(out), 1
+	}
+	if d.overrun() {
+		return out, fmt.Errorf("datos delta truncados: %d de %d bytes", len(out), size)
+	}
+	return out, nil
+}
+
+// patch implementa `kryptr patch referencia delta [salida]`: reconstruye el
+// archivo a partir de la referencia y del delta creado con --delta-from.
+func patch(args []string) int {
+	if len(args) < 2 || len(args) > 3 {
+		fmt.Fprintln(os.Stderr, "Uso: kryptr patch referencia delta [salida]")
+		return 2
+	}
+	ref, err := ioutil.ReadFile(args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error leyendo la referencia %s: %v\n", args[0], err)
+		return 1
+	}
+	out := ""
+	if len(args) == 3 {
+		out = args[2]
+	}
+	deltaRef = ref
+	if !descomprimir(args[1], out) {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// TestDelta comprueba el delta de una versión editada de la referencia: la ida
+// y vuelta, que ocupe mucho menos que comprimir el archivo solo y que se
+// rechace una referencia distinta.
+func TestDelta(t *testing.T) {
+	defer func(r []byte) { deltaRef = r }(deltaRef)
+	rng := rand.New(rand.NewSource(2004))
+	var ref []byte
+	for len(ref) < 256*1024 {
+		ref = append(ref, dictSamples(rng, 1)[0]...)
+	}
+	target := append([]byte{}, ref...)
+	for i := 0; i < 100; i++ {
+		p := rng.Intn(len(target) - 64)
+		switch rng.Intn(3) {
+		case 0: // inserción
+			target = append(target[:p], append([]byte(fmt.Sprintf("nuevo-%d", i)), target[p:]...)...)
+		case 1: // borrado
+			target = append(target[:p], target[p+1+rng.Intn(50):]...)
+		default: // reemplazo
+			target[p] ^= 0x20
+		}
+	}
+
+	inputs := testInputs()
+	cases := [][2][]byte{{ref, target}, {ref, ref}, {ref, nil}, {inputs["texto"], inputs["aleatorio"]}, {{}, inputs["texto"]}}
+	for _, c := range cases {
+		packed, err := deltaCompress(c[1], c[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := deltaDecompress(packed, c[0])
+		if err != nil || !bytes.Equal(got, c[1]) {
+			t.Fatalf("ida y vuelta de %d bytes sobre %d: %v", len(c[1]), len(c[0]), err)
+		}
+	}
+
+	packed, err := deltaCompress(target, ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, err := compressPayload(target, methodRange)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(packed) > len(plain)/20 {
+		t.Fatalf("delta de %d bytes, range de %d", len(packed), len(plain))
+	}
+
+	deltaRef = ref
+	packed, err = PackWithMeta(target, "v2.json", methodDelta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, got, err := decompressContainer(packed); err != nil || !bytes.Equal(got, target) {
+		t.Fatalf("contenedor delta: %v", err)
+	}
+	for _, r := range [][]byte{nil, target} {
+		deltaRef = r
+		if _, _, err := decompressContainer(packed); err == nil || !strings.Contains(err.Error(), "referencia") {
+			t.Fatalf("referencia equivocada: error %v", err)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// dictSamples genera registros JSON parecidos entre sí, como los que motivan
+// el método dict.
+func dictSamples(rng *rand.Rand, n int) [][]byte {
+	users := []string{"ana", "luis", "marta", "jorge"}
+	events := []string{"login", "logout", "compra", "error"}
+	samples := make([][]byte, n)
+	for i := range samples {
+		samples[i] = []byte(fmt.Sprintf("{\n  \"id\": %d,\n  \"usuario\": %q,\n  \"evento\": %q,\n"+
+			"  \"timestamp\": \"2026-10-%02dT%02d:%02d:00Z\",\n  \"detalles\": {\"ip\": \"10.0.%d.%d\", \"duracion_ms\": %d}\n}\n",
+			rng.Intn(1e6), users[rng.Intn(len(users))], events[rng.Intn(len(events))],
+			1+rng.Intn(30), rng.Intn(24), rng.Intn(60), rng.Intn(256), rng.Intn(256), rng.Intn(5000)))
+	}
+	return samples
+}
+
+// TestDictionary entrena un diccionario, comprueba que reduce archivos
+// pequeños que no estaban en las muestras y que se detecta un diccionario
+// equivocado o ausente.
+func TestDictionary(t *testing.T) {
+	defer func(d *dictionary) { sharedDict = d }(sharedDict)
+	rng := rand.New(rand.NewSource(2004))
+	d, err := trainDictionary(dictSamples(rng, 200), 4096)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(d.content) == 0 || len(d.content) > 4096 {
+		t.Fatalf("contenido de %d bytes, esperado 1..4096", len(d.content))
+	}
+	raw := d.marshal()
+	if parsed, err := parseDictionary(raw); err != nil || parsed.id != d.id || !bytes.Equal(parsed.content, d.content) {
+		t.Fatalf("diccionario serializado: %v", err)
+	}
+	bad := append([]byte{}, raw...)
+	bad[20] ^= 1
+	if _, err := parseDictionary(bad); err == nil {
+		t.Fatal("no se detectó un diccionario dañado")
+	}
+
+	plain, withDict := 0, 0
+	inputs := testInputs()
+	tests := append(dictSamples(rng, 50), inputs["alfabeto"], inputs["vacío"], inputs["texto"])
+	for _, data := range tests {
+		packed, err := dictCompress(data, d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := dictDecode(packed, uint64(len(data)), d)
+		if err != nil || !bytes.Equal(got, data) {
+			t.Fatalf("ida y vuelta de %d bytes: %v", len(data), err)
+		}
+		plain += len(deflateCompress(data, lzssConfig))
+		withDict += len(packed)
+	}
+	if withDict > plain/2 {
+		t.Fatalf("con diccionario %d bytes, con deflate %d", withDict, plain)
+	}
+
+	// El ID del diccionario va en el encabezado: sin él o con otro no se
+	// descomprime. El contenedor añade a los códigos magic, nombre, ID,
+	// longitud y CRC32C.
+	sharedDict = d
+	packed, err := PackWithMeta(tests[0], "a.json", methodDict)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isDictContainer(packed) || string(packed[6:12]) != "a.json" || binary.BigEndian.Uint32(packed[12:]) != d.id {
+		t.Fatalf("encabezado del contenedor con diccionario: %x", packed[:16])
+	}
+	if extra := len(packed) - len(dictEncode(tests[0], d)); extra > 4+2+6+4+2+4 {
+		t.Fatalf("el contenedor con diccionario añade %d bytes", extra)
+	}
+	if name, got, err := decompressContainer(packed); err != nil || name != "a.json" || !bytes.Equal(got, tests[0]) {
+		t.Fatalf("contenedor con diccionario: %v", err)
+	}
+	other, _ := trainDictionary(dictSamples(rng, 20), 1024)
+	for _, sd := range []*dictionary{nil, other} {
+		sharedDict = sd
+		if _, _, err := decompressContainer(packed); err == nil || !strings.Contains(err.Error(), fmt.Sprintf("%08x", d.id)) {
+			t.Fatalf("diccionario equivocado: error %v", err)
+		}
+	}
+
+	// methodDict solo se lee en un contenedor KRYD
+	sharedDict = d
+	payload, _ := dictCompress(tests[0], d)
+	digest := sha256.Sum256(tests[0])
+	kryc := append(packHeader("a.json", methodDict), payload...)
+	kryc = append(kryc, containerTrailer(crc32.Checksum(payload, crc32c), digest[:])...)
+	if _, _, err := decompressContainer(kryc); err == nil {
+		t.Fatal("se aceptó un contenedor KRYC con método dict")
+	}
+}
@@ -6,6 +6,12 @@ import (
 	"syscall"
 )
 
+// Clave y número de rondas usados por el cifrado XOR simplificado.
+var (
+	xorKey    = []byte("KEY")
+	xorRounds = 5
+)
+
 // generateRoundKey creates a slightly modified version of the key for each round.
 func generateRoundKey(baseKey []byte, round int) []byte {
 	roundKey := make([]byte, len(baseKey))
@@ -142,8 +148,8 @@ func mkdirAll(path string, mode uint32) error {
 }
 
 func Encriptar(inPath, outPath string) {
-	key := []byte("KEY")
-	rounds := 5
+	key := xorKey
+	rounds := xorRounds
 
 	inPathNoExtension := strings.Split(inPath, ".")[0]
 
@@ -245,8 +251,8 @@ func Encriptar(inPath, outPath string) {
 }
 
 func Desencriptar(inPath, outPath string) {
-	key := []byte("KEY")
-	rounds := 5
+	key := xorKey
+	rounds := xorRounds
 
 	inPathNoExtension := strings.Split(inPath, ".")[0]
 
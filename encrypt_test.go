@@ -0,0 +1,33 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestXorRoundTrip(t *testing.T) {
+	for name, data := range testInputs() {
+		if got := xorDecrypt(xorEncrypt(data, xorKey, xorRounds), xorKey, xorRounds); !bytes.Equal(got, data) {
+			t.Fatalf("entrada %q no coincide", name)
+		}
+	}
+}
+
+func TestXorStream(t *testing.T) {
+	for name, data := range testInputs() {
+		var enc bytes.Buffer
+		if err := xorStream(&enc, bytes.NewReader(data), xorKey, xorRounds, false); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(enc.Bytes(), xorEncrypt(data, xorKey, xorRounds)) {
+			t.Fatalf("entrada %q: el flujo difiere de xorEncrypt", name)
+		}
+		var dec bytes.Buffer
+		if err := xorStream(&dec, &enc, xorKey, xorRounds, true); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(dec.Bytes(), data) {
+			t.Fatalf("entrada %q no coincide", name)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Nombre del filtro registrado en la configuración de git y en .gitattributes.
+const gitFilterName = "kryptr"
+
+// gitFilter implementa `kryptr git-filter clean|smudge`: lee stdin y escribe
+// en stdout el contenido cifrado (clean, al hacer commit) o descifrado
+// (smudge, al hacer checkout). Devuelve el código de salida del proceso.
+func gitFilter(args []string) int {
+	if len(args) != 1 || (args[0] != "clean" && args[0] != "smudge") {
+		fmt.Fprintln(os.Stderr, "Uso: kryptr git-filter clean|smudge")
+		return 2
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+	if err := xorStream(out, os.Stdin, xorKey, xorRounds, args[0] == "smudge"); err != nil {
+		fmt.Fprintf(os.Stderr, "Error en git-filter %s: %v\n", args[0], err)
+		return 1
+	}
+	if err := out.Flush(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error escribiendo stdout: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// xorStream cifra (o descifra) src en dst por bloques. Cada bloque, salvo el
+// último, tiene un tamaño múltiplo de la longitud de la clave, así que el
+// resultado es idéntico al de xorEncrypt/xorDecrypt sobre el archivo completo.
+func xorStream(dst io.Writer, src io.Reader, key []byte, rounds int, decrypt bool) error {
+	chunk := make([]byte, len(key)*(32*1024/len(key)+1))
+	for {
+		n, err := io.ReadFull(src, chunk)
+		if n > 0 {
+			var res []byte
+			if decrypt {
+				res = xorDecrypt(chunk[:n], key, rounds)
+			} else {
+				res = xorEncrypt(chunk[:n], key, rounds)
+			}
+			if _, werr := dst.Write(res); werr != nil {
+				return werr
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// gitInit implementa `kryptr git-init [--insecure-fixed-key] [patrón...]`:
+// registra el filtro en la configuración del repositorio actual y añade los
+// patrones dados al .gitattributes de la raíz para que esos archivos se cifren
+// de forma transparente. Mientras no haya un almacén de claves el filtro usa
+// la clave fija del proyecto, que no protege nada, así que solo se configura
+// si se acepta explícitamente con --insecure-fixed-key.
+func gitInit(args []string) int {
+	set := flag.NewFlagSet("git-init", flag.ContinueOnError)
+	insecure := set.Bool("insecure-fixed-key", false, "Acepta cifrar con la clave fija, que cualquiera puede descifrar")
+	if err := set.Parse(args); err != nil {
+		return 2
+	}
+	if !*insecure {
+		fmt.Fprintln(os.Stderr, "kryptr todavía no tiene claves por repositorio: el filtro cifraría con la clave fija")
+		fmt.Fprintln(os.Stderr, "del código fuente y cualquiera con kryptr podría descifrar los archivos.")
+		fmt.Fprintln(os.Stderr, "Si solo quieres ofuscarlos, vuelve a ejecutarlo con --insecure-fixed-key.")
+		return 1
+	}
+	fmt.Fprintln(os.Stderr, "AVISO: los archivos se cifran con la clave fija de kryptr; no queda protegido su contenido.")
+
+	exe, err := os.Executable()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "No se pudo determinar la ruta del ejecutable: %v\n", err)
+		return 1
+	}
+	top, err := exec.Command("git", "rev-parse", "--show-toplevel").Output()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "No se encontró el repositorio git: %v\n", err)
+		return 1
+	}
+
+	// git ejecuta el filtro con la shell: la ruta va entre comillas por si
+	// tiene espacios
+	config := [][2]string{
+		{"filter." + gitFilterName + ".clean", shellQuote(exe) + " git-filter clean"},
+		{"filter." + gitFilterName + ".smudge", shellQuote(exe) + " git-filter smudge"},
+		{"filter." + gitFilterName + ".required", "true"},
+	}
+	for _, kv := range config {
+		cmd := exec.Command("git", "config", kv[0], kv[1])
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error ejecutando git config %s: %v\n", kv[0], err)
+			return 1
+		}
+	}
+
+	if set.NArg() > 0 {
+		path := filepath.Join(strings.TrimSpace(string(top)), ".gitattributes")
+		existing, err := ioutil.ReadFile(path)
+		if err != nil && !os.IsNotExist(err) {
+			fmt.Fprintf(os.Stderr, "Error leyendo %s: %v\n", path, err)
+			return 1
+		}
+		if add := gitAttributesLines(existing, set.Args()); add != "" {
+			f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error abriendo %s: %v\n", path, err)
+				return 1
+			}
+			defer f.Close()
+			if _, err := f.WriteString(add); err != nil {
+				fmt.Fprintf(os.Stderr, "Error escribiendo %s: %v\n", path, err)
+				return 1
+			}
+		}
+	}
+
+	fmt.Println("Filtro git configurado:", gitFilterName)
+	return 0
+}
+
+// gitAttributesLines devuelve las líneas que hay que añadir a un
+// .gitattributes con contenido existing para que los patrones usen el
+// filtro. Omite los patrones que ya lo tienen, así que ejecutar git-init de
+// nuevo no repite líneas.
+func gitAttributesLines(existing []byte, patterns []string) string {
+	present := make(map[string]bool)
+	for _, line := range strings.Split(string(existing), "\n") {
+		fields := strings.Fields(line)
+		for _, attr := range fields[min(1, len(fields)):] {
+			if attr == "filter="+gitFilterName {
+				present[fields[0]] = true
+			}
+		}
+	}
+	var add strings.Builder
+	for _, pattern := range patterns {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" || present[pattern] {
+			continue
+		}
+		present[pattern] = true
+		add.WriteString(pattern + " filter=" + gitFilterName + " -diff\n")
+	}
+	// El archivo existente puede no terminar en salto de línea
+	if add.Len() > 0 && len(existing) > 0 && existing[len(existing)-1] != '\n' {
+		return "\n" + add.String()
+	}
+	return add.String()
+}
+
+// shellQuote pone s entre comillas simples para sh.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
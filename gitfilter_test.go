@@ -0,0 +1,26 @@
+package main
+
+import "testing"
+
+// TestGitAttributesLines comprueba que git-init no repite los patrones que ya
+// usan el filtro y que respeta un .gitattributes sin salto de línea final.
+func TestGitAttributesLines(t *testing.T) {
+	cases := []struct {
+		name     string
+		existing string
+		patterns []string
+		want     string
+	}{
+		{"vacío", "", []string{"*.key", "secretos/**"}, "*.key filter=kryptr -diff\nsecretos/** filter=kryptr -diff\n"},
+		{"repetido", "*.key filter=kryptr -diff\n", []string{"*.key", "*.pem"}, "*.pem filter=kryptr -diff\n"},
+		{"todos presentes", "*.txt text\n*.key filter=kryptr -diff\n", []string{"*.key"}, ""},
+		{"otro filtro", "*.key filter=lfs\n", []string{"*.key"}, "*.key filter=kryptr -diff\n"},
+		{"sin salto final", "*.txt text", []string{"*.key"}, "\n*.key filter=kryptr -diff\n"},
+		{"repetido en los argumentos", "", []string{"*.key", " *.key "}, "*.key filter=kryptr -diff\n"},
+	}
+	for _, c := range cases {
+		if got := gitAttributesLines([]byte(c.existing), c.patterns); got != c.want {
+			t.Errorf("%s: %q, esperado %q", c.name, got, c.want)
+		}
+	}
+}
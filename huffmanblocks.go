@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"kryptr/utils"
+)
+
+// Marcador del formato Huffman por bloques. Tras el marcador va la longitud
+// original (uint64 BE) y los bloques, cada uno con:
+// banderas | longitud uint32 BE | longitudes de código (si no se reutiliza la
+// tabla anterior) | bytes codificados uint32 BE | bits codificados.
+const huffmanBlocks byte = 3
+
+// Bandera de bloque: usar la tabla del bloque anterior.
+const huffmanBlockReuse byte = 1
+
+// Bytes de entrada por bloque de Huffman usados por huffmanCompress.
+var huffmanBlockSize = 1 << 15
+
+// huffmanCost devuelve los bits necesarios para codificar freq con lengths,
+// o -1 si algún símbolo presente no tiene código.
+func huffmanCost(freq []int, lengths []uint8) int {
+	bits := 0
+	for s, f := range freq {
+		if f == 0 {
+			continue
+		}
+		if lengths[s] == 0 {
+			return -1
+		}
+		bits += f * int(lengths[s])
+	}
+	return bits
+}
+
+// huffmanCompressBlocks codifica data en bloques de blockSize bytes. Cada
+// bloque usa su propia tabla salvo que reutilizar la anterior ocupe menos.
+func huffmanCompressBlocks(data []byte, blockSize int) []byte {
+	out := make([]byte, 9, 9+len(data)/2)
+	out[0] = huffmanBlocks
+	binary.BigEndian.PutUint64(out[1:], uint64(len(data)))
+
+	var prev []uint8
+	for off := 0; off < len(data); off += blockSize {
+		block := data[off:min(off+blockSize, len(data))]
+		freq := make([]int, 256)
+		for _, b := range block {
+			freq[b]++
+		}
+
+		lengths := huffmanCodeLengths(freq, huffmanMaxCodeLen)
+		table := writeCodeLengths(lengths)
+		flags := byte(0)
+		if prev != nil {
+			if reuse := huffmanCost(freq, prev); reuse >= 0 && (reuse+7)/8 <= len(table)+(huffmanCost(freq, lengths)+7)/8 {
+				flags, lengths, table = huffmanBlockReuse, prev, nil
+			}
+		}
+		prev = lengths
+
+		codes := canonicalCodes(lengths)
+		var bw utils.BitWriter
+		for _, b := range block {
+			bw.WriteBits(codes[b].bits, codes[b].length)
+		}
+		coded := bw.Finalize()
+
+		out = append(out, flags)
+		out = binary.BigEndian.AppendUint32(out, uint32(len(block)))
+		out = append(out, table...)
+		out = binary.BigEndian.AppendUint32(out, uint32(len(coded)))
+		out = append(out, coded...)
+	}
+	return out
+}
+
+// huffmanDecompressBlocks invierte huffmanCompressBlocks.
+func huffmanDecompressBlocks(packed []byte) ([]byte, error) {
+	if len(packed) < 9 || packed[0] != huffmanBlocks {
+		return nil, fmt.Errorf("encabezado Huffman por bloques inválido")
+	}
+	size := binary.BigEndian.Uint64(packed[1:])
+	rest := packed[9:]
+
+	out := make([]byte, 0, min(size, uint64(len(packed))*8))
+	var table *huffmanTable
+	for block := 0; uint64(len(out)) < size; block++ {
+		if len(rest) < 5 {
+			return out, fmt.Errorf("bloque %d truncado", block)
+		}
+		flags := rest[0]
+		n := binary.BigEndian.Uint32(rest[1:])
+		rest = rest[5:]
+		if uint64(n) > size-uint64(len(out)) {
+			return out, fmt.Errorf("bloque %d: %d bytes exceden la longitud original", block, n)
+		}
+
+		if flags&huffmanBlockReuse == 0 {
+			lengths, used, err := readCodeLengths(rest)
+			if err != nil {
+				return out, fmt.Errorf("bloque %d: %v", block, err)
+			}
+			rest = rest[used:]
+			dict := make(map[huffmanCode]byte)
+			for s, code := range canonicalCodes(lengths) {
+				if code.length > 0 {
+					dict[code] = byte(s)
+				}
+			}
+			table = buildHuffmanTable(dict)
+		} else if table == nil {
+			return out, fmt.Errorf("bloque %d reutiliza una tabla inexistente", block)
+		}
+
+		if len(rest) < 4 {
+			return out, fmt.Errorf("bloque %d truncado", block)
+		}
+		codedLen := binary.BigEndian.Uint32(rest)
+		if uint64(codedLen) > uint64(len(rest)-4) {
+			return out, fmt.Errorf("bloque %d truncado", block)
+		}
+		decoded, err := decodeSymbolsTable(table, rest[4:4+codedLen], int(n))
+		out = append(out, decoded...)
+		if err != nil {
+			return out, fmt.Errorf("bloque %d: %v", block, err)
+		}
+		rest = rest[4+codedLen:]
+	}
+	return out, nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+// TestHuffmanBlocks comprime una entrada cuyo contenido cambia a mitad de
+// archivo: los bloques de texto reutilizan la tabla, el cambio a datos
+// aleatorios obliga a una tabla nueva, y un bloque dañado se detecta.
+func TestHuffmanBlocks(t *testing.T) {
+	inputs := testInputs()
+	text := bytes.Repeat([]byte("Proyecto Final de Sistemas Operativos. "), 200)
+	data := append(append(append([]byte(nil), text...), inputs["aleatorio"]...), inputs["sesgado"]...)
+	const blockSize = 4096
+
+	packed := huffmanCompressBlocks(data, blockSize)
+	got, err := huffmanDecompressBlocks(packed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatal("la ida y vuelta no coincide")
+	}
+	if single := huffmanCompressSingle(data); len(packed) >= len(single) {
+		t.Fatalf("por bloques %d bytes, con una tabla %d", len(packed), len(single))
+	}
+
+	// Recorrer los bloques y contar los que reutilizan la tabla
+	reused, rest := 0, packed[9:]
+	for len(rest) > 0 {
+		used := 5
+		if rest[0]&huffmanBlockReuse != 0 {
+			reused++
+		} else {
+			_, n, err := readCodeLengths(rest[5:])
+			if err != nil {
+				t.Fatal(err)
+			}
+			used += n
+		}
+		used += 4 + int(binary.BigEndian.Uint32(rest[used:]))
+		rest = rest[used:]
+	}
+	if reused == 0 {
+		t.Fatal("ningún bloque reutilizó la tabla anterior")
+	}
+
+	// Una longitud de más de 4 GiB se lee completa: faltan bloques y debe fallar
+	huge := append([]byte(nil), packed[:9]...)
+	binary.BigEndian.PutUint64(huge[1:], 5<<30)
+	if _, err := huffmanDecompressBlocks(huge); err == nil {
+		t.Fatal("se aceptó un archivo sin bloques")
+	}
+	if _, err := huffmanDecompressBlocks(packed[:len(packed)/2]); err == nil {
+		t.Fatal("se aceptó un archivo truncado")
+	}
+
+	// Longitudes sobresuscritas (un código de 1 bit y 254 de 15): se rechazan
+	// en lugar de desbordar la tabla de decodificación
+	lengths := writeCodeLengths(append([]uint8{1, 1}, bytes.Repeat([]byte{15}, 254)...))
+	bad := append([]byte{huffmanBlocks, 0, 0, 0, 0, 0, 0, 0, 5, 0, 0, 0, 0, 5}, lengths...)
+	bad = append(bad, 0, 0, 0, 2, 0xff, 0xff)
+	if _, err := huffmanDecompressBlocks(bad); err == nil || !strings.Contains(err.Error(), "sobresuscrito") {
+		t.Fatalf("longitudes sobresuscritas: error %v", err)
+	}
+	if _, err := decompressPayload(append([]byte{huffmanCanonical}, lengths...), methodHuffman); err == nil {
+		t.Fatal("longitudes sobresuscritas aceptadas en el formato de una tabla")
+	}
+}
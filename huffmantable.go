@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"kryptr/utils"
+)
+
+// Bits que resuelve cada nivel de la tabla de decodificación. Los códigos
+// canónicos (máx. 15 bits) casi siempre se resuelven en un solo acceso; los
+// códigos largos del formato anterior continúan en subtablas.
+const huffmanTableBits = 11
+
+type huffmanEntry struct {
+	symbol uint16
+	length uint8         // bits consumidos en este nivel (0 = código inválido)
+	sub    *huffmanTable // no nil si el código continúa en otra tabla
+}
+
+type huffmanTable struct {
+	bits    uint8
+	entries []huffmanEntry
+}
+
+// buildHuffmanTable construye la tabla a partir del diccionario código → símbolo,
+// sea canónico o derivado del árbol serializado.
+func buildHuffmanTable(codes map[huffmanCode]byte) *huffmanTable {
+	wide := make(map[huffmanCode]uint16, len(codes))
+	for code, sym := range codes {
+		wide[code] = uint16(sym)
+	}
+	return buildCodeTable(wide)
+}
+
+// buildCodeTable construye la tabla para un alfabeto de más de 256 símbolos,
+// como el de literales y longitudes de DEFLATE.
+func buildCodeTable(codes map[huffmanCode]uint16) *huffmanTable {
+	maxLen := uint8(0)
+	for code := range codes {
+		if code.length > maxLen {
+			maxLen = code.length
+		}
+	}
+	bits := maxLen
+	if bits > huffmanTableBits {
+		bits = huffmanTableBits
+	}
+
+	t := &huffmanTable{bits: bits, entries: make([]huffmanEntry, 1<<bits)}
+	long := make(map[uint64]map[huffmanCode]uint16)
+	for code, sym := range codes {
+		if code.length > bits {
+			rest := code.length - bits
+			prefix := code.bits >> rest
+			if long[prefix] == nil {
+				long[prefix] = make(map[huffmanCode]uint16)
+			}
+			long[prefix][huffmanCode{bits: code.bits & (1<<rest - 1), length: rest}] = sym
+			continue
+		}
+		// Todas las entradas que empiezan por code resuelven al mismo símbolo
+		shift := bits - code.length
+		base := code.bits << shift
+		for k := uint64(0); k < 1<<shift; k++ {
+			t.entries[base+k] = huffmanEntry{symbol: sym, length: code.length}
+		}
+	}
+	for prefix, rest := range long {
+		t.entries[prefix] = huffmanEntry{length: bits, sub: buildCodeTable(rest)}
+	}
+	return t
+}
+
+// decodeSymbolsTable decodifica lenMessage símbolos consultando la tabla con
+// tantos bits como indique cada nivel, en lugar de un bit por búsqueda.
+func decodeSymbolsTable(t *huffmanTable, data []byte, lenMessage int) ([]byte, error) {
+	// Cada símbolo ocupa al menos un bit: lenMessage viene de la carga y no se
+	// reserva más de lo que data puede contener
+	out := make([]byte, 0, min(lenMessage, len(data)*8))
+	r := utils.NewBitReader(data)
+
+	for len(out) < lenMessage {
+		e := huffmanEntry{sub: t}
+		for e.sub != nil {
+			e = e.sub.entries[r.Peek(e.sub.bits)]
+			if e.length == 0 {
+				return out, fmt.Errorf("código inválido en el bit %d", r.BitsConsumed())
+			}
+			r.Consume(e.length)
+		}
+		if r.Overrun() {
+			return out, fmt.Errorf("datos truncados: %d de %d símbolos", len(out), lenMessage)
+		}
+		out = append(out, byte(e.symbol))
+	}
+	return out, nil
+}
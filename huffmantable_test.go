@@ -0,0 +1,38 @@
+package main
+
+import (
+	"bytes"
+	"kryptr/utils"
+	"testing"
+)
+
+// TestHuffmanTableLongCodes decodifica códigos de hasta 30 bits, como los que
+// puede contener un árbol del formato anterior, a través de varias subtablas.
+func TestHuffmanTableLongCodes(t *testing.T) {
+	dict := make(map[huffmanCode]byte)
+	enc := make(map[byte]huffmanCode)
+	for k := uint8(0); k <= 30; k++ {
+		// k unos seguidos de un cero; el último código son 30 unos
+		code := huffmanCode{bits: 1<<k - 1, length: k}
+		if k < 30 {
+			code = code.child(0)
+		}
+		dict[code] = k
+		enc[k] = code
+	}
+
+	var data []byte
+	var bw utils.BitWriter
+	for i := 0; i < 500; i++ {
+		s := byte((i * 7) % 31)
+		data = append(data, s)
+		bw.WriteBits(enc[s].bits, enc[s].length)
+	}
+	got, err := decodeSymbolsTable(buildHuffmanTable(dict), bw.Finalize(), len(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatal("la decodificación no coincide")
+	}
+}
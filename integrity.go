@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// Bit del byte de método que marca un contenedor con sumas de verificación:
+// tras el byte de método va el CRC32C del encabezado, y tras la carga el
+// CRC32C de la carga y el SHA-256 del contenido original.
+const methodChecked byte = 0x80
+
+// Magic de los contenedores. Los verificados se escriben con checkedMagic y
+// además con methodChecked, así que un KRYC al que se le cambie el magic por
+// KRYP queda con un método inválido en lugar de leerse como uno sin sumas.
+const (
+	containerMagic = "KRYP"
+	checkedMagic   = "KRYC"
+)
+
+// Bytes que ocupan las sumas al final de un contenedor verificado.
+const containerTrailerLen = 4 + sha256.Size
+
+var crc32c = crc32.MakeTable(crc32.Castagnoli)
+
+// containerTrailer devuelve las sumas que cierran un contenedor verificado.
+func containerTrailer(payloadCRC uint32, digest []byte) []byte {
+	out := binary.BigEndian.AppendUint32(nil, payloadCRC)
+	return append(out, digest...)
+}
+
+// blockError es un fallo en un bloque concreto de una carga por bloques.
+type blockError struct {
+	block  int
+	offset int64 // desplazamiento del bloque en el archivo comprimido
+	err    error
+}
+
+func (e *blockError) Error() string {
+	return fmt.Sprintf("bloque %d (desplazamiento %d): %v", e.block, e.offset, e.err)
+}
+
+// shiftBlockError suma base al desplazamiento de un blockError, para pasar de
+// la posición en la carga a la posición en el archivo.
+func shiftBlockError(err error, base int64) error {
+	var be *blockError
+	if errors.As(err, &be) {
+		be.offset += base
+	}
+	return err
+}
+
+// parseContainerHeader lee el encabezado KRYP o KRYC del principio de packed
+// y comprueba su CRC32C si lo tiene. Devuelve la longitud del encabezado.
+func parseContainerHeader(packed []byte) (name string, method byte, headerLen int, checked bool, err error) {
+	if len(packed) < 6 || !isContainer(packed) {
+		return "", 0, 0, false, fmt.Errorf("no es un contenedor KRYP")
+	}
+	// Un KRYC siempre se verifica, tenga o no el bit methodChecked
+	checked = string(packed[:4]) == checkedMagic
+	nameLen := int(binary.BigEndian.Uint16(packed[4:6]))
+	if len(packed) < 6+nameLen {
+		return "", 0, 0, checked, fmt.Errorf("encabezado KRYP truncado")
+	}
+	name = string(packed[6 : 6+nameLen])
+	if !checked {
+		// Sin byte de método: carga Huffman de versiones anteriores
+		if len(packed) == 6+nameLen || packed[6+nameLen] <= huffmanCanonical {
+			return name, methodHuffman, 6 + nameLen, false, nil
+		}
+		return name, packed[6+nameLen], 6 + nameLen + 1, false, nil
+	}
+
+	headerLen = 6 + nameLen + 1 + 4
+	if len(packed) < headerLen {
+		return name, 0, 0, true, fmt.Errorf("encabezado KRYP truncado")
+	}
+	want := binary.BigEndian.Uint32(packed[headerLen-4:])
+	if got := crc32.Checksum(packed[:headerLen-4], crc32c); got != want {
+		return name, 0, 0, true, fmt.Errorf("encabezado dañado (desplazamiento 0): CRC32C %08x, esperado %08x", got, want)
+	}
+	return name, packed[headerLen-5] &^ methodChecked, headerLen, true, nil
+}
+
+// isContainer indica si packed empieza con el magic de un contenedor.
+func isContainer(packed []byte) bool {
+	return len(packed) >= 4 && (string(packed[:4]) == containerMagic || string(packed[:4]) == checkedMagic)
+}
+
+// decompressContainer descomprime un archivo completo: gzip, .Z, KRYD o KRYP,
+// con o sin sumas de verificación. En un contenedor verificado comprueba el
+// encabezado, cada bloque, la carga y el SHA-256 del resultado.
+func decompressContainer(packed []byte) (string, []byte, error) {
+	if isGzip(packed) {
+		return gunzipData(packed)
+	}
+	if isLZW(packed) {
+		out, err := lzwDecompress(packed)
+		return "", out, err
+	}
+	if isDictContainer(packed) {
+		return unpackDict(packed, sharedDict)
+	}
+	name, method, headerLen, checked, err := parseContainerHeader(packed)
+	if err != nil && !checked {
+		// Carga Huffman sin contenedor
+		out, err := decompressPayload(packed, methodHuffman)
+		return "", out, err
+	}
+	if err != nil {
+		return name, nil, err
+	}
+	if !checked {
+		out, err := decompressPayload(packed[headerLen:], method)
+		return name, out, err
+	}
+
+	if len(packed) < headerLen+containerTrailerLen {
+		return name, nil, fmt.Errorf("archivo truncado: faltan las sumas de verificación")
+	}
+	payload := packed[headerLen : len(packed)-containerTrailerLen]
+	trailer := packed[len(packed)-containerTrailerLen:]
+	want := binary.BigEndian.Uint32(trailer)
+	got := crc32.Checksum(payload, crc32c)
+
+	damaged := fmt.Errorf("carga dañada (desplazamiento %d): CRC32C %08x, esperado %08x", headerLen, got, want)
+	// En una carga por bloques se descomprime igual para localizar el bloque dañado
+	if got != want && method != methodBlocked {
+		return name, nil, damaged
+	}
+	out, err := decompressPayload(payload, method)
+	var be *blockError
+	if errors.As(err, &be) {
+		return name, nil, shiftBlockError(err, int64(headerLen))
+	}
+	if got != want {
+		return name, nil, damaged
+	}
+	if err != nil {
+		return name, nil, err
+	}
+	if sum := sha256.Sum256(out); !bytes.Equal(sum[:], trailer[4:]) {
+		return name, nil, fmt.Errorf("el contenido no coincide con el SHA-256 guardado")
+	}
+	return name, out, nil
+}
+
+// tailReader entrega lo que lee de r salvo los últimos n bytes, que quedan
+// en tail al llegar al final. Sirve para leer como flujo una carga seguida
+// de las sumas de verificación.
+type tailReader struct {
+	r    io.Reader
+	n    int
+	buf  []byte
+	tmp  []byte
+	done bool
+	err  error
+}
+
+func newTailReader(r io.Reader, n int) *tailReader {
+	return &tailReader{r: r, n: n, tmp: make([]byte, 32*1024)}
+}
+
+func (t *tailReader) Read(p []byte) (int, error) {
+	for len(t.buf) <= t.n && !t.done {
+		k, err := t.r.Read(t.tmp)
+		t.buf = append(t.buf, t.tmp[:k]...)
+		if err != nil {
+			t.done = true
+			if err != io.EOF {
+				t.err = err
+			}
+		}
+	}
+	avail := len(t.buf) - t.n
+	if avail <= 0 {
+		if t.err != nil {
+			return 0, t.err
+		}
+		return 0, io.EOF
+	}
+	k := copy(p, t.buf[:avail])
+	t.buf = append(t.buf[:0], t.buf[k:]...)
+	return k, nil
+}
+
+// tail devuelve los últimos n bytes; solo es válido tras leer hasta io.EOF.
+func (t *tailReader) tail() ([]byte, error) {
+	if len(t.buf) < t.n {
+		return nil, fmt.Errorf("archivo truncado: faltan las sumas de verificación")
+	}
+	return t.buf, nil
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math/rand"
+	"runtime"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+// TestContainerIntegrity daña un byte de cada zona del contenedor y comprueba
+// que decompressContainer lo detecta y, en un bloque, indica su desplazamiento.
+func TestContainerIntegrity(t *testing.T) {
+	defer func(size int) { parallelBlockSize = size }(parallelBlockSize)
+	parallelBlockSize = 1024
+	data := testInputs()["texto"]
+
+	small, err := PackWithMeta(data[:1000], "a.txt", methodLZSS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blocked, err := PackWithMeta(data, "a.txt", methodHuffman)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, packed := range [][]byte{small, blocked} {
+		if _, got, err := decompressContainer(packed); err != nil || !bytes.Equal(got, data[:len(got)]) {
+			t.Fatalf("sin daños: %v", err)
+		}
+	}
+
+	headerLen := 6 + len("a.txt") + 1 + 4
+	payload := blocked[headerLen : len(blocked)-containerTrailerLen]
+	h, idx, err := openBlocks(bytes.NewReader(payload), int64(len(payload)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	block := int64(headerLen) + int64(idx.offsets[2])
+
+	cases := []struct {
+		name   string
+		packed []byte
+		pos    int
+		flip   byte
+		want   string
+	}{
+		{"encabezado", small, 7, 0x10, "encabezado dañado"},
+		{"método", small, headerLen - 5, 0x10, "encabezado dañado"},
+		{"magic", small, 3, 'C' ^ 'P', "desconocido"},
+		{"bit de sumas", small, headerLen - 5, methodChecked, "encabezado dañado"},
+		{"carga", small, headerLen + 3, 0x10, "carga dañada"},
+		{"CRC de la carga", small, len(small) - containerTrailerLen, 0x10, "carga dañada"},
+		{"SHA-256", small, len(small) - 1, 0x10, "SHA-256"},
+		{"bloque", blocked, int(block) + 10, 0x10, fmt.Sprintf("bloque 2 (desplazamiento %d)", block)},
+		{"encabezado de bloques", blocked, headerLen + 2, 0x10, "carga dañada"},
+	}
+	for _, c := range cases {
+		bad := append([]byte{}, c.packed...)
+		bad[c.pos] ^= c.flip
+		_, _, err := decompressContainer(bad)
+		if err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Fatalf("%s: error %v, esperado %q", c.name, err, c.want)
+		}
+	}
+
+	// Extraer un rango solo verifica los bloques que lee
+	bad := append([]byte{}, payload...)
+	bad[idx.offsets[2]+10] ^= 0x10
+	if _, err := extractRange(bytes.NewReader(bad), int64(len(bad)), 0, h.blockSize); err != nil {
+		t.Fatalf("rango sin el bloque dañado: %v", err)
+	}
+	if _, err := extractRange(bytes.NewReader(bad), int64(len(bad)), 0, 3*h.blockSize); err == nil {
+		t.Fatal("rango con el bloque dañado: no se detectó")
+	}
+
+	// Los contenedores sin sumas siguen siendo legibles
+	legacy := append([]byte("KRYP\x00\x01a"), methodLZSS)
+	plain, _ := compressPayload(data, methodLZSS)
+	if _, got, err := decompressContainer(append(legacy, plain...)); err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("contenedor sin sumas: %v", err)
+	}
+}
+
+// corruptions devuelve variantes dañadas de packed: truncadas, con bytes
+// cambiados, con el encabezado al máximo y con el resto reemplazado por ruido.
+func corruptions(rng *rand.Rand, packed []byte) [][]byte {
+	var out [][]byte
+	for k := 0; k < 8; k++ {
+		out = append(out, packed[:len(packed)*k/8])
+	}
+	out = append(out, packed[:len(packed)-1])
+	for i := 0; i < 60 && len(packed) > 0; i++ {
+		bad := append([]byte{}, packed...)
+		bad[rng.Intn(len(bad))] ^= byte(1 + rng.Intn(255))
+		out = append(out, bad)
+	}
+	for _, keep := range []int{0, 1, 9, 20} {
+		if keep > len(packed) {
+			continue
+		}
+		noise := append([]byte{}, packed[:keep]...)
+		for len(noise) < keep+64 {
+			noise = append(noise, byte(rng.Intn(256)))
+		}
+		out = append(out, noise)
+	}
+	huge := append([]byte{}, packed...)
+	for i := 0; i < min(9, len(huge)); i++ {
+		huge[i] = 0xff
+	}
+	return append(out, huge)
+}
+
+// decodeGuarded descomprime payload y convierte un pánico en error. Devuelve
+// también los bytes que reservó la decodificación.
+func decodeGuarded(decode func() ([]byte, error)) (err error, panicked bool, alloc uint64) {
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	defer func() {
+		if r := recover(); r != nil {
+			err, panicked = fmt.Errorf("pánico: %v", r), true
+		}
+		runtime.ReadMemStats(&after)
+		alloc = after.TotalAlloc - before.TotalAlloc
+	}()
+	_, err = decode()
+	return err, false, alloc
+}
+
+// TestCorruptPayloads pasa cargas dañadas a cada decodificador: ninguna debe
+// provocar un pánico ni reservar memoria desproporcionada, una carga
+// truncada debe dar error y, dentro de un contenedor, cualquier daño también.
+func TestCorruptPayloads(t *testing.T) {
+	defer func(d *dictionary, r []byte) { sharedDict, deltaRef = d, r }(sharedDict, deltaRef)
+	defer func(size int) { parallelBlockSize = size }(parallelBlockSize)
+	rng := rand.New(rand.NewSource(30))
+	inputs := testInputs()
+	data := append(append([]byte{}, inputs["texto"][:3000]...), inputs["sesgado"][:3000]...)
+	sharedDict, _ = trainDictionary(dictSamples(rng, 50), 2048)
+	deltaRef = append(append([]byte{}, inputs["sesgado"][:3000]...), inputs["texto"][:2000]...)
+	const maxAlloc = 256 << 20
+
+	methods := map[string]byte{"bloques": methodBlocked, "delta": methodDelta}
+	for name, m := range compressionMethods {
+		methods[name] = m
+	}
+	parallelBlockSize = 2000
+	for name, method := range methods {
+		var payload []byte
+		var err error
+		if method == methodBlocked {
+			payload, err = compressBlocks(data, methodLZSS, 1500, 2)
+		} else {
+			payload, err = compressPayload(data, method)
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		decode := func(p []byte) ([]byte, error) { return decompressPayload(p, method) }
+		if method == methodDict {
+			// La carga de dict solo va en un contenedor KRYD, que lleva la longitud
+			decode = func(p []byte) ([]byte, error) { return dictDecode(p, uint64(len(data)), sharedDict) }
+		}
+		for i, bad := range corruptions(rng, payload) {
+			err, panicked, alloc := decodeGuarded(func() ([]byte, error) { return decode(bad) })
+			if panicked || alloc > maxAlloc {
+				t.Fatalf("%s, caso %d (%d bytes): %v, %d MB reservados", name, i, len(bad), err, alloc>>20)
+			}
+			// Truncar una carga guardada tal cual o un flujo .Z, que no lleva la
+			// longitud, solo acorta el resultado
+			if i < 9 && err == nil && method != methodStored && method != methodLZW {
+				t.Fatalf("%s: carga truncada a %d de %d bytes aceptada", name, len(bad), len(payload))
+			}
+		}
+
+		packed, err := PackWithMeta(data, "a.txt", method)
+		if method == methodBlocked {
+			packed, err = PackWithMeta(data, "a.txt", methodHuffman)
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		for i, bad := range corruptions(rng, packed) {
+			if bytes.Equal(bad, packed) {
+				continue
+			}
+			err, panicked, alloc := decodeGuarded(func() ([]byte, error) {
+				_, out, err := decompressContainer(bad)
+				return out, err
+			})
+			if panicked || alloc > maxAlloc || err == nil {
+				t.Fatalf("%s, contenedor dañado %d (%d bytes): %v, %d MB reservados", name, i, len(bad), err, alloc>>20)
+			}
+		}
+	}
+
+	// Índice con el bloque 1 a un byte del 0, que declara casi 2 GB: el
+	// índice se rechaza antes de reservar el bloque, también dentro de un
+	// contenedor cuyo CRC de la carga es correcto
+	payload, err := compressBlocks(data, methodLZSS, 1500, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := (len(data) + 1499) / 1500
+	crafted := append([]byte{}, payload...)
+	binary.BigEndian.PutUint32(crafted[13:], 1<<31-1)
+	binary.BigEndian.PutUint64(crafted[len(crafted)-8-12*n+12:], 14)
+	digest := sha256.Sum256(data)
+	packed := append(packHeader("a.txt", methodBlocked), crafted...)
+	packed = append(packed, containerTrailer(crc32.Checksum(crafted, crc32c), digest[:])...)
+	for name, decode := range map[string]func() ([]byte, error){
+		"carga":      func() ([]byte, error) { return decompressPayload(crafted, methodBlocked) },
+		"contenedor": func() ([]byte, error) { _, out, err := decompressContainer(packed); return out, err },
+	} {
+		err, panicked, alloc := decodeGuarded(decode)
+		if panicked || alloc > maxAlloc || err == nil {
+			t.Fatalf("índice con bloques solapados, %s: %v, %d MB reservados", name, err, alloc>>20)
+		}
+	}
+}
+
+// TestStreamIntegrity comprueba que el contenedor escrito como flujo es el
+// mismo que el de PackWithMeta y que al leerlo se verifican sus sumas.
+func TestStreamIntegrity(t *testing.T) {
+	data := testInputs()["sesgado"]
+	var packed bytes.Buffer
+	if err := comprimirFlujo(&packed, iotest.OneByteReader(bytes.NewReader(data)), ""); err != nil {
+		t.Fatal(err)
+	}
+	if mem, _ := PackWithMeta(data, "", methodAdaptive); !bytes.Equal(packed.Bytes(), mem) {
+		t.Fatal("el flujo difiere del contenedor en memoria")
+	}
+	var plain bytes.Buffer
+	if err := descomprimirFlujo(&plain, bufio.NewReader(iotest.OneByteReader(bytes.NewReader(packed.Bytes())))); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(plain.Bytes(), data) {
+		t.Fatal("la salida no coincide")
+	}
+
+	n := packed.Len()
+	for _, pos := range []int{6, 9, n / 2, n - containerTrailerLen, n - 1} {
+		bad := append([]byte{}, packed.Bytes()...)
+		bad[pos] ^= 0x01
+		if err := descomprimirFlujo(io.Discard, bufio.NewReader(bytes.NewReader(bad))); err == nil {
+			t.Fatalf("byte %d dañado: no se detectó", pos)
+		}
+	}
+	if err := descomprimirFlujo(io.Discard, bufio.NewReader(bytes.NewReader(packed.Bytes()[:n-3]))); err == nil {
+		t.Fatal("flujo truncado: no se detectó")
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+// TestCompressionLevels comprueba que el nivel por defecto coincide con los
+// parámetros por defecto, que cada nivel produce datos legibles y que -9 no
+// comprime peor que -1 salvo en huff.
+func TestCompressionLevels(t *testing.T) {
+	saved := struct {
+		lzss       lzssParams
+		bwtBlock   int
+		bwtEntropy byte
+		lzwBits    uint8
+		candidates []byte
+		block      int
+		huffBlock  int
+	}{lzssConfig, bwtBlockSize, bwtEntropy, lzwMaxBits, autoCandidates, parallelBlockSize, huffmanBlockSize}
+	defer func() {
+		lzssConfig, bwtBlockSize, bwtEntropy = saved.lzss, saved.bwtBlock, saved.bwtEntropy
+		lzwMaxBits, autoCandidates = saved.lzwBits, saved.candidates
+		parallelBlockSize, huffmanBlockSize = saved.block, saved.huffBlock
+	}()
+
+	if err := applyCompressionLevel(defaultCompressionLevel); err != nil {
+		t.Fatal(err)
+	}
+	if lzssConfig != saved.lzss || bwtBlockSize != saved.bwtBlock || bwtEntropy != saved.bwtEntropy ||
+		lzwMaxBits != saved.lzwBits || !bytes.Equal(autoCandidates, saved.candidates) ||
+		parallelBlockSize != saved.block || huffmanBlockSize != saved.huffBlock {
+		t.Fatalf("el nivel %d no coincide con los valores por defecto", defaultCompressionLevel)
+	}
+	if applyCompressionLevel(0) == nil || applyCompressionLevel(10) == nil {
+		t.Fatal("se aceptó un nivel fuera de rango")
+	}
+
+	data := logInput(256 * 1024)
+	methods := []byte{methodHuffman, methodLZSS, methodDeflate, methodLZW, methodRange, methodBWT}
+	sizes := make(map[byte][]int)
+	for level := 1; level <= 9; level++ {
+		applyCompressionLevel(level)
+		for _, m := range methods {
+			packed, err := compressPayload(data, m)
+			if err != nil {
+				t.Fatalf("-%d %q: %v", level, m, err)
+			}
+			got, err := decompressPayload(packed, m)
+			if err != nil || !bytes.Equal(got, data) {
+				t.Fatalf("-%d %q: ida y vuelta: %v", level, m, err)
+			}
+			sizes[m] = append(sizes[m], len(packed))
+		}
+	}
+	// En huff el nivel cambia el tamaño de bloque por velocidad; según los
+	// datos los bloques grandes ocupan más o menos
+	for _, m := range methods[1:] {
+		if s := sizes[m]; s[8] > s[0] {
+			t.Fatalf("%q: -9 ocupa %d bytes, -1 %d", m, s[8], s[0])
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"kryptr/utils"
+	"math/bits"
+)
+
+// Longitud mínima de una coincidencia; las más cortas se emiten como literales.
+const lzssMinMatch = 3
+
+// Longitud máxima de una coincidencia en cualquier formato que use lzParse.
+const lzssMaxMatch = lzssMinMatch + 1<<16 - 1
+
+// Bits del índice de la tabla hash de las cadenas de coincidencias.
+const lzssHashBits = 15
+
+// lzssParams configura el buscador de coincidencias.
+type lzssParams struct {
+	window    int // tamaño de la ventana deslizante en bytes (potencia de 2)
+	lookahead int // longitud máxima de una coincidencia
+	maxChain  int // posiciones de la cadena hash a revisar por búsqueda
+}
+
+// Parámetros usados por comprimir; main los ajusta con --lz-window y --lz-lookahead.
+var lzssConfig = lzssParams{window: 1 << 15, lookahead: 258, maxChain: 128}
+
+// validate ajusta window a la siguiente potencia de 2 y comprueba los límites del formato.
+func (p lzssParams) validate() (lzssParams, error) {
+	if p.window < 1<<8 || p.window > 1<<24 {
+		return p, fmt.Errorf("ventana LZSS fuera de rango (256..16777216): %d", p.window)
+	}
+	if p.lookahead < lzssMinMatch+1 || p.lookahead > lzssMaxMatch {
+		return p, fmt.Errorf("lookahead LZSS fuera de rango (%d..%d): %d", lzssMinMatch+1, lzssMaxMatch, p.lookahead)
+	}
+	if p.maxChain < 1 {
+		p.maxChain = 1
+	}
+	p.window = 1 << bits.Len(uint(p.window-1))
+	return p, nil
+}
+
+func lzssHash(b []byte) uint32 {
+	v := uint32(b[0])<<16 | uint32(b[1])<<8 | uint32(b[2])
+	return (v * 2654435761) >> (32 - lzssHashBits)
+}
+
+// lzParse recorre data con el buscador de coincidencias por cadenas hash y
+// llama a literal por cada byte sin coincidencia y a match por cada par
+// (longitud, distancia) de al menos lzssMinMatch bytes. p debe estar validado.
+func lzParse(data []byte, p lzssParams, literal func(b byte), match func(length, dist int)) {
+	lzParseFrom(data, 0, p, literal, match)
+}
+
+// lzParseFrom es lzParse empezando en start: los bytes anteriores (un
+// diccionario) solo sirven como destino de las coincidencias.
+func lzParseFrom(data []byte, start int, p lzssParams, literal func(b byte), match func(length, dist int)) {
+	// head guarda la última posición de cada hash y prev encadena las anteriores
+	head := make([]int32, 1<<lzssHashBits)
+	for i := range head {
+		head[i] = -1
+	}
+	prev := make([]int32, p.window)
+	windowMask := p.window - 1
+	insert := func(i int) {
+		if i+lzssMinMatch <= len(data) {
+			h := lzssHash(data[i:])
+			prev[i&windowMask] = head[h]
+			head[h] = int32(i)
+		}
+	}
+
+	for i := 0; i < start; i++ {
+		insert(i)
+	}
+	for i := start; i < len(data); {
+		bestLen, bestDist := 0, 0
+		if i+lzssMinMatch <= len(data) {
+			limit := p.lookahead
+			if len(data)-i < limit {
+				limit = len(data) - i
+			}
+			cand := int(head[lzssHash(data[i:])])
+			for chain := p.maxChain; cand >= 0 && i-cand <= p.window && chain > 0; chain-- {
+				if data[cand+bestLen] == data[i+bestLen] {
+					l := 0
+					for l < limit && data[cand+l] == data[i+l] {
+						l++
+					}
+					if l > bestLen {
+						bestLen, bestDist = l, i-cand
+						if l == limit {
+							break
+						}
+					}
+				}
+				next := int(prev[cand&windowMask])
+				if next >= cand {
+					break // la entrada ya fue sobrescrita por una posición más nueva
+				}
+				cand = next
+			}
+		}
+
+		if bestLen >= lzssMinMatch {
+			match(bestLen, bestDist)
+			for end := i + bestLen; i < end; i++ {
+				insert(i)
+			}
+		} else {
+			literal(data[i])
+			insert(i)
+			i++
+		}
+	}
+}
+
+// lzssCompress codifica data como literales y pares (distancia, longitud).
+// Formato: longitud original uint64 BE | bits de distancia | bits de longitud |
+// tokens: bit 0 + literal de 8 bits, o bit 1 + (distancia-1) + (longitud-lzssMinMatch).
+func lzssCompress(data []byte, p lzssParams) ([]byte, error) {
+	p, err := p.validate()
+	if err != nil {
+		return nil, err
+	}
+	offsetBits := uint8(bits.Len(uint(p.window - 1)))
+	lengthBits := uint8(bits.Len(uint(p.lookahead - lzssMinMatch)))
+
+	header := make([]byte, 10)
+	binary.BigEndian.PutUint64(header, uint64(len(data)))
+	header[8], header[9] = offsetBits, lengthBits
+
+	var bw utils.BitWriter
+	lzParse(data, p, func(b byte) {
+		bw.WriteBits(0, 1)
+		bw.WriteBits(uint64(b), 8)
+	}, func(length, dist int) {
+		bw.WriteBits(1, 1)
+		bw.WriteBits(uint64(dist-1), offsetBits)
+		bw.WriteBits(uint64(length-lzssMinMatch), lengthBits)
+	})
+
+	return append(header, bw.Finalize()...), nil
+}
+
+func lzssDecompress(payload []byte) ([]byte, error) {
+	if len(payload) < 10 {
+		return nil, fmt.Errorf("encabezado LZSS incompleto")
+	}
+	size := binary.BigEndian.Uint64(payload)
+	offsetBits, lengthBits := payload[8], payload[9]
+	if offsetBits > 24 || lengthBits == 0 || lengthBits > 16 {
+		return nil, fmt.Errorf("parámetros LZSS inválidos: %d/%d bits", offsetBits, lengthBits)
+	}
+
+	// size viene de la carga: se reserva como mucho 64 veces su tamaño y
+	// append crece si hace falta
+	out := make([]byte, 0, min(size, uint64(len(payload))*64))
+	r := utils.NewBitReader(payload[10:])
+	for uint64(len(out)) < size {
+		if r.ReadBits(1) == 0 {
+			out = append(out, byte(r.ReadBits(8)))
+		} else {
+			dist := int(r.ReadBits(offsetBits)) + 1
+			length := int(r.ReadBits(lengthBits)) + lzssMinMatch
+			if dist > len(out) {
+				return out, fmt.Errorf("distancia %d fuera de la salida (%d bytes)", dist, len(out))
+			}
+			if uint64(len(out)+length) > size {
+				return out, fmt.Errorf("la coincidencia excede la longitud original")
+			}
+			// Copia byte a byte: la coincidencia puede solaparse con lo que copia
+			for k := 0; k < length; k++ {
+				out = append(out, out[len(out)-dist])
+			}
+		}
+		if r.Overrun() {
+			return out, fmt.Errorf("datos LZSS truncados: %d de %d bytes", len(out), size)
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func TestLZSSRoundTrip(t *testing.T) {
+	params := []lzssParams{
+		lzssConfig,
+		{window: 256, lookahead: 4, maxChain: 1},
+		{window: 1 << 20, lookahead: 1 << 16, maxChain: 4096},
+	}
+	for _, p := range params {
+		for name, data := range testInputs() {
+			packed, err := lzssCompress(data, p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := lzssDecompress(packed)
+			if err != nil {
+				t.Fatalf("entrada %q, %+v: %v", name, p, err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Fatalf("entrada %q, %+v no coincide", name, p)
+			}
+		}
+	}
+
+	// Una longitud original enorme en el encabezado no reserva memoria: falla
+	// al acabarse los datos
+	for _, size := range []uint64{1 << 62, 1 << 34} {
+		bad := binary.BigEndian.AppendUint64(nil, size)
+		bad = append(bad, 12, 4, 0x55, 0x55)
+		if _, err := lzssDecompress(bad); err == nil {
+			t.Fatalf("longitud %d aceptada", size)
+		}
+	}
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"fmt"
+	"kryptr/utils"
+)
+
+// Formato .Z de compress(1): firma 1F 9D, un byte con el máximo de bits del
+// código (y 0x80 en modo bloque) y los códigos empaquetados desde el bit menos
+// significativo. El código 256 vacía el diccionario y los códigos nuevos
+// empiezan en 257.
+const (
+	lzwMagic0    = 0x1f
+	lzwMagic1    = 0x9d
+	lzwBlockMode = 0x80
+	lzwMinBits   = 9
+	lzwClear     = 256
+	lzwFirst     = 257
+	// Cada cuántos bytes de entrada se revisa la razón de compresión con el
+	// diccionario lleno para decidir si se vacía, como en compress(1).
+	lzwCheckGap = 10000
+)
+
+// Máximo de bits por código (9..16); los niveles de compresión lo ajustan.
+var lzwMaxBits uint8 = 16
+
+// lzwWriter emite códigos como compress(1): en grupos de 8 códigos (n_bits
+// bytes), rellenando el grupo incompleto cada vez que cambia el ancho del
+// código o se vacía el diccionario, que es lo que espera el decodificador.
+type lzwWriter struct {
+	w        utils.LSBBitWriter
+	bits     uint8
+	maxBits  uint8
+	maxCode  int
+	segStart uint64 // bit donde empezó el grupo actual de códigos
+	// Imagen del diccionario del decodificador, que va un código por detrás
+	decFree  int
+	decFirst bool
+}
+
+func (lw *lzwWriter) align() {
+	group := uint64(lw.bits) * 8
+	if rem := (lw.w.BitsWritten() - lw.segStart) % group; rem != 0 {
+		for pad := group - rem; pad > 0; {
+			n := pad
+			if n > 32 {
+				n = 32
+			}
+			lw.w.WriteBits(0, uint8(n))
+			pad -= n
+		}
+	}
+	lw.segStart = lw.w.BitsWritten()
+}
+
+// lzwMaxCode es el mayor código admitido con el ancho dado antes de ensanchar.
+// Al inicio y tras CLEAR el decodificador usa 511 aunque maxBits sea 9.
+func lzwMaxCode(bits, maxBits uint8) int {
+	if bits > lzwMinBits && bits == maxBits {
+		return 1 << maxBits
+	}
+	return 1<<bits - 1
+}
+
+func (lw *lzwWriter) emit(code int) {
+	if lw.decFree > lw.maxCode {
+		lw.align()
+		lw.bits++
+		lw.maxCode = lzwMaxCode(lw.bits, lw.maxBits)
+	}
+	lw.w.WriteBits(uint64(code), lw.bits)
+	if lw.decFirst {
+		lw.decFirst = false
+	} else if lw.decFree < 1<<lw.maxBits {
+		lw.decFree++
+	}
+}
+
+func (lw *lzwWriter) clear() {
+	lw.emit(lzwClear)
+	lw.align()
+	lw.bits, lw.maxCode = lzwMinBits, lzwMaxCode(lzwMinBits, lw.maxBits)
+	// Tras CLEAR el decodificador vuelve a 256 y el primer código añade una entrada sin uso
+	lw.decFree = lzwClear
+}
+
+// lzwCompress produce un archivo .Z completo, legible por uncompress.
+func lzwCompress(data []byte, maxBits uint8) ([]byte, error) {
+	if maxBits < lzwMinBits || maxBits > 16 {
+		return nil, fmt.Errorf("bits LZW fuera de rango (9..16): %d", maxBits)
+	}
+	header := []byte{lzwMagic0, lzwMagic1, maxBits | lzwBlockMode}
+	if len(data) == 0 {
+		return header, nil
+	}
+
+	lw := &lzwWriter{bits: lzwMinBits, maxBits: maxBits, maxCode: lzwMaxCode(lzwMinBits, maxBits), decFree: lzwFirst, decFirst: true}
+	maxEntries := 1 << maxBits
+
+	dict := make(map[uint32]int)
+	free := lzwFirst
+	checkpoint := lzwCheckGap
+	bestRatio := uint64(0)
+
+	prefix := int(data[0])
+	for i := 1; i < len(data); i++ {
+		key := uint32(prefix)<<8 | uint32(data[i])
+		if code, ok := dict[key]; ok {
+			prefix = code
+			continue
+		}
+		lw.emit(prefix)
+		prefix = int(data[i])
+
+		if free < maxEntries {
+			dict[key] = free
+			free++
+			continue
+		}
+		// Diccionario lleno: vaciarlo si la razón de compresión empeora
+		if i >= checkpoint {
+			checkpoint = i + lzwCheckGap
+			ratio := uint64(i) << 16 / (lw.w.BitsWritten()/8 + 1)
+			if ratio < bestRatio {
+				bestRatio = 0
+				lw.clear()
+				dict = make(map[uint32]int)
+				free = lzwFirst
+			} else {
+				bestRatio = ratio
+			}
+		}
+	}
+	lw.emit(prefix)
+
+	return append(header, lw.w.Finalize()...), nil
+}
+
+// isLZW indica si data empieza con la firma de compress(1).
+func isLZW(data []byte) bool {
+	return len(data) >= 3 && data[0] == lzwMagic0 && data[1] == lzwMagic1
+}
+
+// lzwDecompress decodifica un archivo .Z siguiendo el decodificador de
+// compress(1), incluido el salto al final de cada grupo de códigos.
+func lzwDecompress(data []byte) ([]byte, error) {
+	if !isLZW(data) {
+		return nil, fmt.Errorf("firma .Z inválida")
+	}
+	maxBits := data[2] & 0x1f
+	block := data[2]&lzwBlockMode != 0
+	if maxBits < lzwMinBits || maxBits > 16 {
+		return nil, fmt.Errorf("bits LZW fuera de rango (9..16): %d", maxBits)
+	}
+
+	r := utils.NewLSBBitReader(data[3:])
+	total := uint64(len(data)-3) * 8
+	maxEntries := 1 << maxBits
+	prefixOf := make([]uint16, maxEntries)
+	suffixOf := make([]byte, maxEntries)
+
+	bits := uint8(lzwMinBits)
+	maxCode := lzwMaxCode(bits, maxBits)
+	segStart := uint64(0)
+	align := func() {
+		group := uint64(bits) * 8
+		if rem := (r.BitsConsumed() - segStart) % group; rem != 0 {
+			for pad := group - rem; pad > 0; {
+				n := pad
+				if n > 32 {
+					n = 32
+				}
+				r.ReadBits(uint8(n))
+				pad -= n
+			}
+		}
+		segStart = r.BitsConsumed()
+	}
+
+	free := lzwClear
+	if block {
+		free = lzwFirst
+	}
+	oldCode := -1
+	var finChar byte
+	var out, stack []byte
+	for {
+		if free > maxCode {
+			align()
+			bits++
+			maxCode = lzwMaxCode(bits, maxBits)
+		}
+		if r.BitsConsumed()+uint64(bits) > total {
+			break
+		}
+		code := int(r.ReadBits(bits))
+
+		if oldCode == -1 {
+			if code >= 256 {
+				return out, fmt.Errorf("primer código inválido: %d", code)
+			}
+			finChar = byte(code)
+			out = append(out, finChar)
+			oldCode = code
+			continue
+		}
+		if code == lzwClear && block {
+			align()
+			bits, maxCode = lzwMinBits, lzwMaxCode(lzwMinBits, maxBits)
+			free = lzwClear
+			continue
+		}
+
+		inCode := code
+		stack = stack[:0]
+		if code >= free {
+			// Caso KwKwK: el código aún no existe y es el anterior + su primer byte
+			if code > free {
+				return out, fmt.Errorf("código %d fuera del diccionario (%d)", code, free)
+			}
+			stack = append(stack, finChar)
+			code = oldCode
+		}
+		for code >= 256 {
+			stack = append(stack, suffixOf[code])
+			code = int(prefixOf[code])
+		}
+		finChar = byte(code)
+		stack = append(stack, finChar)
+		for k := len(stack) - 1; k >= 0; k-- {
+			out = append(out, stack[k])
+		}
+
+		if free < maxEntries {
+			prefixOf[free] = uint16(oldCode)
+			suffixOf[free] = finChar
+			free++
+		}
+		oldCode = inCode
+	}
+	return out, nil
+}
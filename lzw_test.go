@@ -0,0 +1,29 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+// TestLZWRoundTrip recorre varios máximos de bits. La entrada "mixto" llena el
+// diccionario de 9 bits con texto y luego empeora la razón con datos
+// aleatorios, lo que fuerza códigos CLEAR.
+func TestLZWRoundTrip(t *testing.T) {
+	inputs := testInputs()
+	inputs["mixto"] = append(bytes.Repeat([]byte("Proyecto Final de Sistemas Operativos. "), 2000), inputs["aleatorio"]...)
+	for _, maxBits := range []uint8{9, 12, 16} {
+		for name, data := range inputs {
+			packed, err := lzwCompress(data, maxBits)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := lzwDecompress(packed)
+			if err != nil {
+				t.Fatalf("entrada %q, %d bits: %v", name, maxBits, err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Fatalf("entrada %q, %d bits no coincide", name, maxBits)
+			}
+		}
+	}
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"runtime"
+	"sync"
+)
+
+// Método del contenedor para archivos grandes: los datos se dividen en bloques
+// independientes que se comprimen en paralelo con el método interno.
+// Formato: método interno | longitud original uint64 BE | tamaño de bloque
+// uint32 BE | por bloque: longitud de la carga uint32 BE | carga | índice con el
+// desplazamiento y el CRC32C de cada bloque (ver readBlockIndex).
+const methodBlocked byte = 'P'
+
+// Bit de la longitud de un bloque que indica que se guardó sin comprimir porque
+// el método interno no lo reducía. Los bloques miden como mucho 1<<30 bytes.
+const blockStored uint32 = 1 << 31
+
+// Firma al final del índice de bloques.
+const blockIndexMagic = "KIDC"
+
+// blockIndex ubica los bloques de una carga y guarda el CRC32C de cada uno;
+// end es donde terminan los bloques (el inicio del índice).
+type blockIndex struct {
+	offsets []uint64
+	crcs    []uint32
+	end     uint64
+}
+
+// Archivos mayores que parallelBlockSize se comprimen por bloques con
+// parallelWorkers goroutines; main ajusta los trabajadores con --workers.
+var (
+	parallelBlockSize = 1 << 20
+	parallelWorkers   = runtime.NumCPU()
+)
+
+// compressBlocks comprime cada bloque con compressPayload usando workers
+// goroutines. Los bloques no dependen entre sí y se escriben en orden, así que
+// la salida es la misma para cualquier número de trabajadores.
+func compressBlocks(data []byte, method byte, blockSize, workers int) ([]byte, error) {
+	if blockSize < 1 || blockSize > 1<<30 {
+		return nil, fmt.Errorf("tamaño de bloque fuera de rango: %d", blockSize)
+	}
+	n := (len(data) + blockSize - 1) / blockSize
+	workers = max(1, min(workers, n))
+	results := make([][]byte, n)
+	stored := make([]uint32, n)
+	errs := make([]error, n)
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				block := data[i*blockSize : min((i+1)*blockSize, len(data))]
+				results[i], stored[i], errs[i] = compressBlock(block, method)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	out := make([]byte, 13)
+	out[0] = method
+	binary.BigEndian.PutUint64(out[1:], uint64(len(data)))
+	binary.BigEndian.PutUint32(out[9:], uint32(blockSize))
+	index := make([]byte, 0, 12*n+8)
+	for i, r := range results {
+		if errs[i] != nil {
+			return nil, fmt.Errorf("bloque %d: %v", i, errs[i])
+		}
+		index = binary.BigEndian.AppendUint64(index, uint64(len(out)))
+		index = binary.BigEndian.AppendUint32(index, crc32.Checksum(r, crc32c))
+		out = binary.BigEndian.AppendUint32(out, uint32(len(r))|stored[i])
+		out = append(out, r...)
+	}
+	index = binary.BigEndian.AppendUint32(index, uint32(n))
+	out = append(out, index...)
+	return append(out, blockIndexMagic...), nil
+}
+
+// compressBlock comprime un bloque con compressOrStore y devuelve blockStored
+// si quedó sin comprimir.
+func compressBlock(block []byte, method byte) ([]byte, uint32, error) {
+	payload, m, err := compressOrStore(block, method)
+	if m == methodStored && method != methodStored {
+		return payload, blockStored, err
+	}
+	return payload, 0, err
+}
+
+// blockHeader es el encabezado de una carga por bloques.
+type blockHeader struct {
+	method    byte
+	size      uint64
+	blockSize uint64
+}
+
+func parseBlockHeader(b []byte) (blockHeader, error) {
+	if len(b) < 13 {
+		return blockHeader{}, fmt.Errorf("encabezado de bloques incompleto")
+	}
+	h := blockHeader{b[0], binary.BigEndian.Uint64(b[1:]), uint64(binary.BigEndian.Uint32(b[9:]))}
+	if h.method == methodBlocked || h.blockSize == 0 {
+		return h, fmt.Errorf("encabezado de bloques inválido")
+	}
+	return h, nil
+}
+
+func (h blockHeader) count() int {
+	return int((h.size + h.blockSize - 1) / h.blockSize)
+}
+
+// blockLen devuelve los bytes originales del bloque i.
+func (h blockHeader) blockLen(i int) uint64 {
+	return min(h.blockSize, h.size-uint64(i)*h.blockSize)
+}
+
+// openBlocks lee el encabezado y el índice de una carga por bloques.
+func openBlocks(r io.ReaderAt, size int64) (blockHeader, blockIndex, error) {
+	buf := make([]byte, 13)
+	if _, err := r.ReadAt(buf, 0); err != nil {
+		return blockHeader{}, blockIndex{}, fmt.Errorf("encabezado de bloques incompleto")
+	}
+	h, err := parseBlockHeader(buf)
+	if err != nil {
+		return h, blockIndex{}, err
+	}
+	// Cada bloque ocupa al menos su prefijo de longitud
+	if h.size/h.blockSize > uint64(size)/4 {
+		return h, blockIndex{}, fmt.Errorf("encabezado de bloques inválido: %d bloques en %d bytes", h.count(), size)
+	}
+	n := h.count()
+
+	idx, ok := readBlockIndex(r, size, n)
+	if !ok {
+		return h, idx, fmt.Errorf("índice de bloques dañado o ausente")
+	}
+	return h, idx, nil
+}
+
+// readBlockIndex lee el índice del final de la carga: por bloque,
+// desplazamiento uint64 BE y CRC32C uint32 BE de la carga | número de bloques
+// uint32 BE | "KIDC".
+func readBlockIndex(r io.ReaderAt, size int64, n int) (blockIndex, bool) {
+	tail := make([]byte, 8)
+	if size < 13+8 || n == 0 {
+		return blockIndex{}, false
+	}
+	if _, err := r.ReadAt(tail, size-8); err != nil {
+		return blockIndex{}, false
+	}
+	const entry = 12
+	if string(tail[4:]) != blockIndexMagic {
+		return blockIndex{}, false
+	}
+	start := size - 8 - int64(entry*n)
+	if int(binary.BigEndian.Uint32(tail)) != n || start < 13 {
+		return blockIndex{}, false
+	}
+	raw := make([]byte, entry*n)
+	if _, err := r.ReadAt(raw, start); err != nil {
+		return blockIndex{}, false
+	}
+	idx := blockIndex{offsets: make([]uint64, n), crcs: make([]uint32, n), end: uint64(start)}
+	for i := range idx.offsets {
+		idx.offsets[i] = binary.BigEndian.Uint64(raw[entry*i:])
+		idx.crcs[i] = binary.BigEndian.Uint32(raw[entry*i+8:])
+		// Cada bloque ocupa al menos su prefijo de longitud
+		if idx.offsets[i] < 13 || idx.offsets[i]+4 > uint64(start) || i > 0 && idx.offsets[i] < idx.offsets[i-1]+4 {
+			return blockIndex{}, false
+		}
+	}
+	return idx, idx.offsets[0] == 13
+}
+
+// readBlock lee, verifica y descomprime el bloque i.
+func readBlock(r io.ReaderAt, h blockHeader, idx blockIndex, i int) ([]byte, error) {
+	off := idx.offsets[i]
+	lenb := make([]byte, 4)
+	if _, err := r.ReadAt(lenb, int64(off)); err != nil {
+		return nil, &blockError{i, int64(off), fmt.Errorf("truncado")}
+	}
+	n := binary.BigEndian.Uint32(lenb)
+	method := h.method
+	if n&blockStored != 0 {
+		n, method = n&^blockStored, methodStored
+	}
+	// El bloque tiene que terminar antes del siguiente o del final de los bloques
+	limit := idx.end
+	if i+1 < len(idx.offsets) {
+		limit = idx.offsets[i+1]
+	}
+	if off+4+uint64(n) > limit {
+		return nil, &blockError{i, int64(off), fmt.Errorf("longitud %d fuera de la carga", n)}
+	}
+	data := make([]byte, n)
+	if _, err := r.ReadAt(data, int64(off)+4); err != nil {
+		return nil, &blockError{i, int64(off), fmt.Errorf("truncado")}
+	}
+	if got := crc32.Checksum(data, crc32c); got != idx.crcs[i] {
+		return nil, &blockError{i, int64(off), fmt.Errorf("CRC32C %08x, esperado %08x", got, idx.crcs[i])}
+	}
+	block, err := decompressPayload(data, method)
+	if err != nil {
+		return nil, &blockError{i, int64(off), err}
+	}
+	if want := h.blockLen(i); uint64(len(block)) != want {
+		return nil, &blockError{i, int64(off), fmt.Errorf("%d bytes, esperado %d", len(block), want)}
+	}
+	return block, nil
+}
+
+// readBlocks descomprime los bloques first..last con parallelWorkers goroutines
+// y los devuelve concatenados.
+func readBlocks(r io.ReaderAt, h blockHeader, idx blockIndex, first, last int) ([]byte, error) {
+	n := last - first + 1
+	results := make([][]byte, n)
+	errs := make([]error, n)
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < max(1, min(parallelWorkers, n)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i-first], errs[i-first] = readBlock(r, h, idx, i)
+			}
+		}()
+	}
+	for i := first; i <= last; i++ {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	var out []byte
+	for i, b := range results {
+		if errs[i] != nil {
+			return out, errs[i]
+		}
+		out = append(out, b...)
+	}
+	return out, nil
+}
+
+// decompressBlocks invierte compressBlocks decodificando los bloques en paralelo.
+func decompressBlocks(payload []byte) ([]byte, error) {
+	r := bytes.NewReader(payload)
+	h, idx, err := openBlocks(r, int64(len(payload)))
+	if err != nil || len(idx.offsets) == 0 {
+		return nil, err
+	}
+	return readBlocks(r, h, idx, 0, len(idx.offsets)-1)
+}
+
+// extractRange devuelve los bytes originales [start, end) de una carga por
+// bloques leyendo y descomprimiendo solo los bloques que los contienen.
+func extractRange(r io.ReaderAt, size int64, start, end uint64) ([]byte, error) {
+	h, idx, err := openBlocks(r, size)
+	if err != nil {
+		return nil, err
+	}
+	end = min(end, h.size)
+	if start >= end {
+		return nil, nil
+	}
+	first, last := int(start/h.blockSize), int((end-1)/h.blockSize)
+	data, err := readBlocks(r, h, idx, first, last)
+	if err != nil {
+		return nil, err
+	}
+	base := uint64(first) * h.blockSize
+	return data[start-base : end-base], nil
+}
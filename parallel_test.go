@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"strings"
+	"testing"
+)
+
+// TestParallelBlocks comprime por bloques con distinto número de trabajadores:
+// la salida debe ser idéntica byte a byte y descomprimirse igual.
+func TestParallelBlocks(t *testing.T) {
+	var data []byte
+	for _, in := range testInputs() {
+		data = append(data, in...)
+	}
+	for alg, method := range compressionMethods {
+		if method == methodDict {
+			continue // necesita un diccionario; lo prueba TestDictionary
+		}
+		var first []byte
+		for _, workers := range []int{1, 3, 16} {
+			packed, err := compressBlocks(data, method, 10000, workers)
+			if err != nil {
+				t.Fatalf("%s: %v", alg, err)
+			}
+			if first == nil {
+				first = packed
+			} else if !bytes.Equal(packed, first) {
+				t.Fatalf("%s: la salida con %d hilos difiere de la de 1 hilo", alg, workers)
+			}
+		}
+		got, err := decompressPayload(first, methodBlocked)
+		if err != nil {
+			t.Fatalf("%s: %v", alg, err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Fatalf("%s: la ida y vuelta no coincide", alg)
+		}
+	}
+}
+
+// countingReaderAt cuenta los bytes leídos con ReadAt.
+type countingReaderAt struct {
+	r    io.ReaderAt
+	read int
+}
+
+func (c *countingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	n, err := c.r.ReadAt(p, off)
+	c.read += n
+	return n, err
+}
+
+// TestBlockIndex extrae rangos usando el índice, comprueba que solo se leen
+// los bloques necesarios y que una carga sin índice se rechaza.
+func TestBlockIndex(t *testing.T) {
+	data := testInputs()["aleatorio"]
+	packed, err := compressBlocks(data, methodHuffman, 4096, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ranges := [][2]uint64{{0, 1}, {4000, 4200}, {4096, 8192}, {60000, 1 << 40}, {10, 10}}
+	for _, rg := range ranges {
+		c := &countingReaderAt{r: bytes.NewReader(packed)}
+		got, err := extractRange(c, int64(len(packed)), rg[0], rg[1])
+		if err != nil {
+			t.Fatalf("rango %v: %v", rg, err)
+		}
+		end := min(rg[1], uint64(len(data)))
+		if !bytes.Equal(got, data[rg[0]:end]) {
+			t.Fatalf("rango %v no coincide", rg)
+		}
+		if c.read > len(packed)/4 {
+			t.Fatalf("rango %v: se leyeron %d de %d bytes", rg, c.read, len(packed))
+		}
+	}
+
+	// Sin índice la carga se rechaza
+	n := (len(data) + 4095) / 4096
+	noIndex := packed[:len(packed)-12*n-8]
+	if _, err := decompressBlocks(noIndex); err == nil || !strings.Contains(err.Error(), "índice") {
+		t.Fatalf("sin índice: error %v", err)
+	}
+
+}
+
+// TestStoredFallback comprueba que los datos que no se reducen se guardan tal
+// cual, en el archivo entero y en cada bloque por separado.
+func TestStoredFallback(t *testing.T) {
+	defer func(size int) { parallelBlockSize = size }(parallelBlockSize)
+	parallelBlockSize = 16 * 1024
+	inputs := testInputs()
+	random, text := inputs["aleatorio"], inputs["texto"]
+
+	for _, method := range []byte{methodHuffman, methodLZSS, methodRange, methodBWT} {
+		packed, err := PackWithMeta(random[:8000], "x", method)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, m, payload := UnpackWithMeta(packed); m != methodStored || !bytes.Equal(payload[:8000], random[:8000]) {
+			t.Fatalf("%q: método %q, esperado %q", method, m, methodStored)
+		}
+		if len(packed) > 8000+64 {
+			t.Fatalf("%q: %d bytes para 8000 de entrada", method, len(packed))
+		}
+	}
+
+	// Bloques alternos de texto y datos aleatorios: solo los aleatorios se guardan
+	var mixed []byte
+	for i := 0; i < 4; i++ {
+		mixed = append(mixed, bytes.Repeat(text, 3)[:16*1024]...)
+		mixed = append(mixed, random[i*16*1024:(i+1)*16*1024]...)
+	}
+	packed, err := compressBlocks(mixed, methodHuffman, 16*1024, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := bytes.NewReader(packed)
+	h, idx, err := openBlocks(r, int64(len(packed)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lenb := make([]byte, 4)
+	for i, off := range idx.offsets {
+		r.ReadAt(lenb, int64(off))
+		if stored := binary.BigEndian.Uint32(lenb)&blockStored != 0; stored != (i%2 == 1) {
+			t.Fatalf("bloque %d: guardado sin comprimir = %v", i, stored)
+		}
+	}
+	got, err := readBlocks(r, h, idx, 0, len(idx.offsets)-1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, mixed) {
+		t.Fatal("bloques mixtos: la salida no coincide")
+	}
+}
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+)
+
+// Codificador de rango binario al estilo de LZMA: cada decisión se codifica
+// con una probabilidad adaptativa de 12 bits, y los bytes y números se
+// descomponen en decisiones binarias con árboles de bits. A diferencia de
+// Huffman no hay que gastar un bit entero por símbolo.
+const (
+	rangeProbBits = 12
+	rangeProbInit = 1 << (rangeProbBits - 1)
+	rangeMoveBits = 5
+	rangeTop      = 1 << 24
+)
+
+// Modelos de --range-model. El byte del modelo va en el encabezado de la carga.
+const (
+	rangeOrder0 byte = 0 // bytes sin contexto
+	rangeOrder1 byte = 1 // bytes con el byte anterior como contexto
+	rangeLZ     byte = 2 // tokens de lzParse; literales con contexto de orden 1
+)
+
+var rangeModels = map[string]byte{"o0": rangeOrder0, "o1": rangeOrder1, "lz": rangeLZ}
+
+// Modelo usado por comprimir; main lo ajusta con --range-model.
+var rangeModel = rangeLZ
+
+type rangeEncoder struct {
+	out       []byte
+	low       uint64
+	rng       uint32
+	cache     byte
+	cacheSize int
+}
+
+func newRangeEncoder() *rangeEncoder {
+	return &rangeEncoder{rng: 0xFFFFFFFF, cacheSize: 1}
+}
+
+// shiftLow emite el byte alto de low, retrasando los 0xFF que aún pueden
+// recibir el acarreo.
+func (e *rangeEncoder) shiftLow() {
+	if uint32(e.low) < 0xFF000000 || e.low>>32 != 0 {
+		carry := byte(e.low >> 32)
+		temp := e.cache
+		for ; e.cacheSize > 0; e.cacheSize-- {
+			e.out = append(e.out, temp+carry)
+			temp = 0xFF
+		}
+		e.cache = byte(e.low >> 24)
+	}
+	e.cacheSize++
+	e.low = (e.low & 0x00FFFFFF) << 8
+}
+
+func (e *rangeEncoder) encodeBit(p *rangeProb, bit uint32) {
+	bound := (e.rng >> rangeProbBits) * p.get()
+	if bit == 0 {
+		e.rng = bound
+	} else {
+		e.low += uint64(bound)
+		e.rng -= bound
+	}
+	p.update(bit)
+	for e.rng < rangeTop {
+		e.rng <<= 8
+		e.shiftLow()
+	}
+}
+
+// encodeTree codifica los n bits bajos de v, del más significativo al menos,
+// usando el prefijo ya codificado como contexto. probs tiene 1<<n entradas.
+func (e *rangeEncoder) encodeTree(probs []rangeProb, n uint8, v uint32) {
+	m := uint32(1)
+	for i := int(n) - 1; i >= 0; i-- {
+		bit := v >> uint(i) & 1
+		e.encodeBit(&probs[m], bit)
+		m = m<<1 | bit
+	}
+}
+
+func (e *rangeEncoder) finish() []byte {
+	for i := 0; i < 5; i++ {
+		e.shiftLow()
+	}
+	return e.out
+}
+
+type rangeDecoder struct {
+	in   []byte
+	pos  int
+	rng  uint32
+	code uint32
+}
+
+func newRangeDecoder(in []byte) (*rangeDecoder, error) {
+	if len(in) < 5 || in[0] != 0 {
+		return nil, fmt.Errorf("flujo del codificador de rango inválido")
+	}
+	d := &rangeDecoder{in: in, pos: 5, rng: 0xFFFFFFFF}
+	d.code = binary.BigEndian.Uint32(in[1:5])
+	return d, nil
+}
+
+func (d *rangeDecoder) decodeBit(p *rangeProb) uint32 {
+	bound := (d.rng >> rangeProbBits) * p.get()
+	var bit uint32
+	if d.code < bound {
+		d.rng = bound
+	} else {
+		d.code -= bound
+		d.rng -= bound
+		bit = 1
+	}
+	p.update(bit)
+	for d.rng < rangeTop {
+		var b byte
+		if d.pos < len(d.in) {
+			b = d.in[d.pos]
+		}
+		d.pos++
+		d.rng <<= 8
+		d.code = d.code<<8 | uint32(b)
+	}
+	return bit
+}
+
+func (d *rangeDecoder) decodeTree(probs []rangeProb, n uint8) uint32 {
+	m := uint32(1)
+	for i := uint8(0); i < n; i++ {
+		m = m<<1 | d.decodeBit(&probs[m])
+	}
+	return m - 1<<n
+}
+
+// overrun indica si se leyó más allá del final del flujo.
+func (d *rangeDecoder) overrun() bool {
+	return d.pos > len(d.in)
+}
+
+// rangeProb estima la probabilidad de que el siguiente bit sea 0. La tasa de
+// adaptación empieza en 1/2 y baja hasta 1/2^rangeMoveBits a medida que el
+// contexto acumula bits: aprende rápido al principio y luego da una
+// estimación estable.
+type rangeProb struct {
+	p     uint16
+	shift uint8
+}
+
+func (p *rangeProb) get() uint32 {
+	return uint32(p.p)
+}
+
+func (p *rangeProb) update(bit uint32) {
+	if bit == 0 {
+		p.p += (1<<rangeProbBits - p.p) >> p.shift
+	} else {
+		p.p -= p.p >> p.shift
+	}
+	if p.shift < rangeMoveBits {
+		p.shift++
+	}
+}
+
+func newProbs(n int) []rangeProb {
+	p := make([]rangeProb, n)
+	for i := range p {
+		p[i] = rangeProb{rangeProbInit, 1}
+	}
+	return p
+}
+
+// rangeNumber modela enteros v < 1<<31 - 1 como la longitud en bits de v+1
+// (árbol de 5 bits) seguida de los bits restantes, cada uno con su probabilidad.
+type rangeNumber struct {
+	lenProbs []rangeProb
+	bitProbs []rangeProb // [longitud][posición del bit]
+}
+
+func newRangeNumber() *rangeNumber {
+	return &rangeNumber{lenProbs: newProbs(1 << 5), bitProbs: newProbs(32 * 32)}
+}
+
+func (m *rangeNumber) encode(e *rangeEncoder, v uint32) {
+	x := v + 1
+	n := bits.Len32(x) - 1
+	e.encodeTree(m.lenProbs, 5, uint32(n))
+	for i := n - 1; i >= 0; i-- {
+		e.encodeBit(&m.bitProbs[n*32+i], x>>uint(i)&1)
+	}
+}
+
+func (m *rangeNumber) decode(d *rangeDecoder) uint32 {
+	n := int(d.decodeTree(m.lenProbs, 5))
+	x := uint32(1)
+	for i := n - 1; i >= 0; i-- {
+		x = x<<1 | d.decodeBit(&m.bitProbs[n*32+i])
+	}
+	return x - 1
+}
+
+// rangeCompress codifica data con el modelo indicado.
+// Formato: longitud original uint64 BE | modelo | flujo del codificador de rango.
+func rangeCompress(data []byte, model byte, p lzssParams) ([]byte, error) {
+	if model > rangeLZ {
+		return nil, fmt.Errorf("modelo de rango desconocido: %d", model)
+	}
+	p, err := p.validate()
+	if err != nil {
+		return nil, err
+	}
+	header := make([]byte, 9)
+	binary.BigEndian.PutUint64(header, uint64(len(data)))
+	header[8] = model
+
+	e := newRangeEncoder()
+	switch model {
+	case rangeOrder0:
+		probs := newProbs(256)
+		for _, b := range data {
+			e.encodeTree(probs, 8, uint32(b))
+		}
+	case rangeOrder1:
+		probs := newProbs(256 * 256)
+		prev := 0
+		for _, b := range data {
+			e.encodeTree(probs[prev<<8:], 8, uint32(b))
+			prev = int(b)
+		}
+	case rangeLZ:
+		lit := newProbs(256 * 256)
+		isMatch := newProbs(2)
+		lengths, dists := newRangeNumber(), newRangeNumber()
+		// El contexto de un literal es el último byte emitido, sea literal o copia
+		pos, state := 0, 0
+		lzParse(data, p, func(b byte) {
+			e.encodeBit(&isMatch[state], 0)
+			prev := 0
+			if pos > 0 {
+				prev = int(data[pos-1])
+			}
+			e.encodeTree(lit[prev<<8:], 8, uint32(b))
+			pos, state = pos+1, 0
+		}, func(length, dist int) {
+			e.encodeBit(&isMatch[state], 1)
+			lengths.encode(e, uint32(length-lzssMinMatch))
+			dists.encode(e, uint32(dist-1))
+			pos, state = pos+length, 1
+		})
+	}
+	return append(header, e.finish()...), nil
+}
+
+func rangeDecompress(payload []byte) ([]byte, error) {
+	if len(payload) < 9 {
+		return nil, fmt.Errorf("encabezado del codificador de rango incompleto")
+	}
+	size := binary.BigEndian.Uint64(payload)
+	model := payload[8]
+	d, err := newRangeDecoder(payload[9:])
+	if err != nil {
+		return nil, err
+	}
+	// Reserva acotada por si la longitud del encabezado está dañada
+	out := make([]byte, 0, min(size, uint64(len(payload))*64))
+
+	switch model {
+	case rangeOrder0:
+		probs := newProbs(256)
+		for uint64(len(out)) < size && !d.overrun() {
+			out = append(out, byte(d.decodeTree(probs, 8)))
+		}
+	case rangeOrder1:
+		probs := newProbs(256 * 256)
+		prev := 0
+		for uint64(len(out)) < size && !d.overrun() {
+			b := byte(d.decodeTree(probs[prev<<8:], 8))
+			out = append(out, b)
+			prev = int(b)
+		}
+	case rangeLZ:
+		lit := newProbs(256 * 256)
+		isMatch := newProbs(2)
+		lengths, dists := newRangeNumber(), newRangeNumber()
+		state := 0
+		for uint64(len(out)) < size && !d.overrun() {
+			if d.decodeBit(&isMatch[state]) == 0 {
+				prev := 0
+				if len(out) > 0 {
+					prev = int(out[len(out)-1])
+				}
+				out = append(out, byte(d.decodeTree(lit[prev<<8:], 8)))
+				state = 0
+				continue
+			}
+			length := int(lengths.decode(d)) + lzssMinMatch
+			dist := int(dists.decode(d)) + 1
+			// Tras el final de los datos el decodificador produce basura: no
+			// se copia nada que no venga de la carga
+			if d.overrun() {
+				break
+			}
+			if length > lzssMaxMatch {
+				return out, fmt.Errorf("coincidencia de %d bytes, el máximo es %d", length, lzssMaxMatch)
+			}
+			if dist > len(out) {
+				return out, fmt.Errorf("distancia %d fuera de la salida (%d bytes)", dist, len(out))
+			}
+			if uint64(len(out)+length) > size {
+				return out, fmt.Errorf("la coincidencia excede la longitud original")
+			}
+			for k := 0; k < length; k++ {
+				out = append(out, out[len(out)-dist])
+			}
+			state = 1
+		}
+	default:
+		return nil, fmt.Errorf("modelo de rango desconocido: %d", model)
+	}
+	if d.overrun() {
+		return out, fmt.Errorf("datos del codificador de rango truncados: %d de %d bytes", len(out), size)
+	}
+	return out, nil
+}
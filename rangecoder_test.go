@@ -0,0 +1,29 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRangeRoundTrip(t *testing.T) {
+	for _, model := range rangeModels {
+		for name, data := range testInputs() {
+			packed, err := rangeCompress(data, model, lzssConfig)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := rangeDecompress(packed)
+			if err != nil {
+				t.Fatalf("entrada %q, modelo %d: %v", name, model, err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Fatalf("entrada %q, modelo %d no coincide", name, model)
+			}
+			if len(data) > 1000 {
+				if _, err := rangeDecompress(packed[:len(packed)/2]); err == nil {
+					t.Fatalf("entrada %q, modelo %d: carga truncada aceptada", name, model)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+)
+
+// selfTest es una prueba de respuesta conocida.
+type selfTest struct {
+	name string
+	run  func() error
+}
+
+var selfTests = []selfTest{
+	{"xor: vector conocido", testXorKnownAnswer},
+	{"huff: vector conocido", testHuffmanKnownAnswer},
+	{"ahuff: vector conocido", testAdaptiveKnownAnswer},
+	{"range: vectores conocidos", testRangeKnownAnswer},
+	{"bwt: vectores conocidos", testBWTKnownAnswer},
+	{"lzss: vector conocido", testLZSSKnownAnswer},
+	{"lzw: vector conocido", testLZWKnownAnswer},
+}
+
+// selftest implementa `kryptr selftest`: comprueba los vectores conocidos de
+// cada formato en el binario instalado y devuelve un código de salida
+// distinto de cero si alguno falla. Las pruebas de ida y vuelta, de
+// corrupción y de compatibilidad con la biblioteca estándar están en los
+// *_test.go de cada backend y se ejecutan con go test ./...
+func selftest() int {
+	failed := 0
+	for _, t := range selfTests {
+		if err := t.run(); err != nil {
+			fmt.Printf("FALLO %s: %v\n", t.name, err)
+			failed++
+		} else {
+			fmt.Printf("ok    %s\n", t.name)
+		}
+	}
+	if failed > 0 {
+		fmt.Printf("%d de %d pruebas fallaron\n", failed, len(selfTests))
+		return 1
+	}
+	fmt.Printf("%d pruebas correctas\n", len(selfTests))
+	return 0
+}
+
+func mustHex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func testXorKnownAnswer() error {
+	plain := []byte("Kryptr: Proyecto Final SI2004")
+	want := mustHex("0037203b312b716509392a202e262d24651f222b3827650a0277697b71")
+	if got := xorEncrypt(plain, []byte("KEY"), 5); !bytes.Equal(got, want) {
+		return fmt.Errorf("cifrado %x, esperado %x", got, want)
+	}
+	if got := xorDecrypt(want, []byte("KEY"), 5); !bytes.Equal(got, plain) {
+		return fmt.Errorf("descifrado %q, esperado %q", got, plain)
+	}
+	return nil
+}
+
+// testHuffmanKnownAnswer decodifica un archivo producido por huffmanCompress
+// (árbol serializado + longitud de 32 bits) para proteger la compatibilidad.
+func testHuffmanKnownAnswer() error {
+	packed := mustHex("00016100016200017200016301640000000b59cf58")
+	want := []byte("abracadabra")
+	if got := huffmanDecompress(packed); !bytes.Equal(got, want) {
+		return fmt.Errorf("descomprimido %q, esperado %q", got, want)
+	}
+	return nil
+}
+
+// testAdaptiveKnownAnswer fija la salida de FGK para "abracadabra": cada
+// símbolo nuevo va tras el código de NYT con 9 bits y el final es el símbolo 256.
+func testAdaptiveKnownAnswer() error {
+	plain := []byte("abracadabra")
+	want := mustHex("308c41c90c6c32364400")
+	got, err := adaptiveHuffmanCompress(plain)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(got, want) {
+		return fmt.Errorf("comprimido %x, esperado %x", got, want)
+	}
+	dec, err := adaptiveHuffmanDecompress(want)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(dec, plain) {
+		return fmt.Errorf("descomprimido %q, esperado %q", dec, plain)
+	}
+	return nil
+}
+
+// testRangeKnownAnswer fija la salida de los tres modelos del codificador de
+// rango para una misma entrada.
+func testRangeKnownAnswer() error {
+	plain := []byte("abracadabra abracadabra")
+	vectors := map[byte]string{
+		rangeOrder0: "00000000000000170000617a47845fcde8504a4f7c57e9faaa",
+		rangeOrder1: "0000000000000017010061626a617c4689d1868c5e6c94a94e2bfde0",
+		rangeLZ:     "0000000000000017020030a4dad4cf61c75004c2d49d9ad400",
+	}
+	for model, v := range vectors {
+		want := mustHex(v)
+		got, err := rangeCompress(plain, model, lzssConfig)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(got, want) {
+			return fmt.Errorf("modelo %d: comprimido %x, esperado %x", model, got, want)
+		}
+		dec, err := rangeDecompress(want)
+		if err != nil {
+			return fmt.Errorf("modelo %d: %v", model, err)
+		}
+		if !bytes.Equal(dec, plain) {
+			return fmt.Errorf("modelo %d: descomprimido %q, esperado %q", model, dec, plain)
+		}
+	}
+	return nil
+}
+
+// testBWTKnownAnswer comprueba la transformada y MTF con rachas por separado.
+func testBWTKnownAnswer() error {
+	last, primary := bwtForward([]byte("banana"))
+	if string(last) != "annbaa" || primary != 4 {
+		return fmt.Errorf("BWT de banana: (%q, %d), esperado (\"annbaa\", 4)", last, primary)
+	}
+	if got, err := bwtInverse(last, primary); err != nil || string(got) != "banana" {
+		return fmt.Errorf("BWT inversa: (%q, %v)", got, err)
+	}
+
+	// "aaab": 'a' está en la posición 97 (símbolo 98), luego una racha de dos
+	// ceros (RUNB) y 'b', que quedó en la posición 98 (símbolo 99)
+	want := []byte{98, bwtRunB, 99}
+	got := mtfEncode([]byte("aaab"))
+	if !bytes.Equal(got, want) {
+		return fmt.Errorf("MTF de aaab: %v, esperado %v", got, want)
+	}
+	if dec, err := mtfDecode(got, 4); err != nil || string(dec) != "aaab" {
+		return fmt.Errorf("MTF inverso: (%q, %v)", dec, err)
+	}
+	return nil
+}
+
+// testLZSSKnownAnswer decodifica un vector fijo con literales y una
+// coincidencia que se solapa consigo misma.
+func testLZSSKnownAnswer() error {
+	want := []byte("abcabcabcabcx")
+	packed := mustHex("000000000000000d080430988c70263c00")
+	got, err := lzssDecompress(packed)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(got, want) {
+		return fmt.Errorf("descomprimido %q, esperado %q", got, want)
+	}
+	if enc, _ := lzssCompress(want, lzssParams{window: 256, lookahead: 18, maxChain: 16}); !bytes.Equal(enc, packed) {
+		return fmt.Errorf("comprimido %x, esperado %x", enc, packed)
+	}
+	return nil
+}
+
+// testLZWKnownAnswer usa el ejemplo clásico de LZW; el vector se comprobó con gzip -dc.
+func testLZWKnownAnswer() error {
+	plain := []byte("TOBEORNOTTOBEORTOBEORNOT")
+	want := mustHex("1f9d90549e0829f2448a932754020e2ca890a04184")
+	got, err := lzwCompress(plain, 16)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(got, want) {
+		return fmt.Errorf("comprimido %x, esperado %x", got, want)
+	}
+	dec, err := lzwDecompress(want)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(dec, plain) {
+		return fmt.Errorf("descomprimido %q, esperado %q", dec, plain)
+	}
+	return nil
+}
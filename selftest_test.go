@@ -0,0 +1,12 @@
+package main
+
+import "testing"
+
+// TestSelfTest ejecuta con go test los vectores conocidos de kryptr selftest.
+func TestSelfTest(t *testing.T) {
+	for _, st := range selfTests {
+		if err := st.run(); err != nil {
+			t.Errorf("%s: %v", st.name, err)
+		}
+	}
+}
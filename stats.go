@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"kryptr/utils"
+)
+
+// Informe de `kryptr stats`: histograma, entropía y códigos Huffman de cada
+// archivo, y lo que ocupa comprimido frente a lo que predicen los códigos.
+
+// byteStat es una fila del histograma.
+type byteStat struct {
+	Byte    byte  `json:"byte"`
+	Count   int   `json:"count"`
+	CodeLen uint8 `json:"code_len"`
+}
+
+// fileStats es el informe de un archivo. Los tamaños están en bytes.
+type fileStats struct {
+	File           string     `json:"file"`
+	Size           int        `json:"size"`
+	Symbols        int        `json:"symbols"`        // bytes distintos
+	Entropy        float64    `json:"entropy"`        // bits por byte, orden 0
+	AvgCodeLen     float64    `json:"avg_code_len"`   // bits por byte con los códigos Huffman
+	Repetitiveness float64    `json:"repetitiveness"` // lo que puede aprovechar un compresor LZ
+	EntropySize    int        `json:"entropy_size"`   // límite de Shannon para orden 0
+	PredictedSize  int        `json:"predicted_size"` // con los códigos, sin tabla ni encabezados
+	Method         string     `json:"method"`         // método de actual_size; store si no reduce
+	ActualSize     int        `json:"actual_size"`    // archivo comprimido, con encabezado y sumas
+	Histogram      []byteStat `json:"histogram"`      // de mayor a menor frecuencia
+}
+
+// fileStatistics calcula el informe de data. Las longitudes de código son las
+// del árbol Huffman sin limitar; huff las limita a 15 bits, lo que solo cambia
+// archivos con frecuencias muy desiguales. El tamaño real es el del archivo
+// que escribiría `kryptr -c`.
+func fileStatistics(name string, data []byte, method byte) (fileStats, error) {
+	s := fileStats{File: name, Size: len(data), Histogram: []byteStat{}}
+	heap := utils.BuildHeap(data)
+	for _, n := range heap {
+		s.Histogram = append(s.Histogram, byteStat{Byte: byte(n.Symbol), Count: n.Freq})
+	}
+	sort.Slice(s.Histogram, func(i, j int) bool {
+		a, b := s.Histogram[i], s.Histogram[j]
+		return a.Count > b.Count || a.Count == b.Count && a.Byte < b.Byte
+	})
+	s.Symbols = len(s.Histogram)
+
+	if len(data) > 0 {
+		codes := make(map[int]huffmanCode)
+		createCompressionDictionary(buildHuffmanTree(&heap), huffmanCode{}, codes)
+		bits := 0
+		for i, h := range s.Histogram {
+			// Con un solo símbolo el árbol es una hoja: huff usa un bit
+			s.Histogram[i].CodeLen = max(codes[int(h.Byte)].length, 1)
+			bits += h.Count * int(s.Histogram[i].CodeLen)
+		}
+		s.Entropy = byteEntropy(data)
+		s.AvgCodeLen = float64(bits) / float64(len(data))
+		s.Repetitiveness = repetitiveness(data)
+		s.EntropySize = int(math.Ceil(s.Entropy * float64(len(data)) / 8))
+		s.PredictedSize = (bits + 7) / 8
+	}
+
+	if method == 0 {
+		method, _ = chooseMethod(data)
+	}
+	packed, err := PackWithMeta(data, filepath.Base(name), method)
+	if err != nil {
+		return s, err
+	}
+	// PackWithMeta guarda sin comprimir lo que el método no reduce
+	if _, m, _, _, err := parseContainerHeader(packed); err == nil && m == methodStored {
+		method = methodStored
+	}
+	s.Method, s.ActualSize = methodName(method), len(packed)
+	return s, nil
+}
+
+// printStats imprime el informe como texto, con las top filas más
+// frecuentes del histograma.
+func printStats(s fileStats, top int) {
+	fmt.Printf("%s: %d bytes, %d símbolos distintos\n", s.File, s.Size, s.Symbols)
+	if s.Size == 0 {
+		return
+	}
+	line := func(label, format string, args ...interface{}) {
+		fmt.Printf("  %-26s "+format+"\n", append([]interface{}{label + ":"}, args...)...)
+	}
+	line("Entropía", "%.4f bits/byte", s.Entropy)
+	line("Longitud media de código", "%.4f bits/byte", s.AvgCodeLen)
+	line("Repetición (LZ)", "%.1f %%", 100*s.Repetitiveness)
+	line("Tamaño según la entropía", "%d bytes (%.1f %%)", s.EntropySize, percent(s.EntropySize, s.Size))
+	line("Tamaño con los códigos", "%d bytes (%.1f %%)", s.PredictedSize, percent(s.PredictedSize, s.Size))
+	line("Archivo con "+s.Method, "%d bytes (%.1f %%)", s.ActualSize, percent(s.ActualSize, s.Size))
+	if s.ActualSize >= s.Size {
+		fmt.Println("  No compensa comprimirlo")
+	}
+
+	fmt.Printf("  %-6s %10s %7s %7s\n", "byte", "veces", "%", "código")
+	for _, h := range s.Histogram[:min(top, len(s.Histogram))] {
+		sym := fmt.Sprintf("%02x", h.Byte)
+		if h.Byte > ' ' && h.Byte < 0x7f {
+			sym = fmt.Sprintf("'%c'", h.Byte)
+		}
+		fmt.Printf("  %-6s %10d %6.2f%% %7d\n", sym, h.Count, percent(h.Count, s.Size), h.CodeLen)
+	}
+	if rest := len(s.Histogram) - top; rest > 0 {
+		fmt.Printf("  ... %d símbolos más (--top 256 para verlos todos)\n", rest)
+	}
+}
+
+func percent(n, total int) float64 {
+	return 100 * float64(n) / float64(total)
+}
+
+// stats implementa `kryptr stats [--json] [--top n] [--comp-alg m] archivos...`.
+func stats(args []string) int {
+	set := flag.NewFlagSet("stats", flag.ContinueOnError)
+	asJSON := set.Bool("json", false, "Imprime el informe en JSON, con el histograma completo")
+	top := set.Int("top", 16, "Filas del histograma en el informe de texto")
+	alg := set.String("comp-alg", "huff", "Método con el que se mide el tamaño real, o auto")
+	if err := set.Parse(args); err != nil {
+		return 2
+	}
+	if set.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "Uso: kryptr stats [--json] [--top n] [--comp-alg método] archivos...")
+		return 2
+	}
+	method := byte(0)
+	if *alg != "auto" {
+		m, ok := compressionMethods[*alg]
+		if !ok || m == methodDict {
+			fmt.Fprintf(os.Stderr, "Algoritmo de compresión no admitido en stats: %s\n", *alg)
+			return 2
+		}
+		method = m
+	}
+
+	var all []fileStats
+	for _, file := range set.Args() {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error leyendo %s: %v\n", file, err)
+			return 1
+		}
+		s, err := fileStatistics(file, data, method)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error comprimiendo %s: %v\n", file, err)
+			return 1
+		}
+		if *asJSON {
+			all = append(all, s)
+		} else {
+			printStats(s, *top)
+		}
+	}
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(all); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+	}
+	return 0
+}
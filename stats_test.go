@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+// TestStats comprueba el informe de stats: el histograma suma el tamaño, los
+// códigos cumplen la desigualdad de Kraft con igualdad y su longitud media
+// queda entre la entropía y la entropía más un bit.
+func TestStats(t *testing.T) {
+	s, err := fileStatistics("abra", []byte("abracadabra"), methodHuffman)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Symbols != 5 || s.Histogram[0] != (byteStat{'a', 5, 1}) || math.Abs(s.Entropy-2.0404) > 1e-4 {
+		t.Fatalf("abracadabra: %d símbolos, primero %+v, entropía %.4f", s.Symbols, s.Histogram[0], s.Entropy)
+	}
+
+	for name, data := range testInputs() {
+		s, err := fileStatistics(name, data, methodHuffman)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		total, kraft := 0, 0.0
+		for _, h := range s.Histogram {
+			total += h.Count
+			kraft += math.Pow(2, -float64(h.CodeLen))
+		}
+		if total != len(data) {
+			t.Fatalf("%s: el histograma suma %d de %d bytes", name, total, len(data))
+		}
+		if len(data) == 0 {
+			continue
+		}
+		if s.Symbols > 1 && math.Abs(kraft-1) > 1e-9 || s.Symbols == 1 && s.Histogram[0].CodeLen != 1 {
+			t.Fatalf("%s: suma de Kraft %.6f", name, kraft)
+		}
+		if s.AvgCodeLen < s.Entropy-1e-9 || s.Symbols > 1 && s.AvgCodeLen >= s.Entropy+1 {
+			t.Fatalf("%s: longitud media %.4f con entropía %.4f", name, s.AvgCodeLen, s.Entropy)
+		}
+		if packed, _ := PackWithMeta(data, name, methodHuffman); s.ActualSize != len(packed) {
+			t.Fatalf("%s: tamaño real %d, archivo con huff %d", name, s.ActualSize, len(packed))
+		}
+		// Lo que huff no reduce se guarda sin comprimir
+		want := "huff"
+		if name == "un byte" || name == "alfabeto" || name == "aleatorio" {
+			want = "store"
+		}
+		if s.Method != want {
+			t.Fatalf("%s: método %s, esperado %s", name, s.Method, want)
+		}
+	}
+
+	raw, err := json.Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var back fileStats
+	if err := json.Unmarshal(raw, &back); err != nil || back.PredictedSize != s.PredictedSize || len(back.Histogram) != s.Symbols {
+		t.Fatalf("JSON: %v", err)
+	}
+}
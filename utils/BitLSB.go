@@ -0,0 +1,111 @@
+package utils
+
+// LSBBitWriter escribe bits empezando por el menos significativo de cada
+// byte, el orden que usa DEFLATE (RFC 1951).
+type LSBBitWriter struct {
+    buf []byte
+    acc uint64 // bits pendientes; el siguiente bit va en la posición n
+    n   uint   // número de bits válidos en acc (0..63)
+}
+
+// WriteBits escribe los length bits menos significativos de value, del bit 0
+// hacia arriba (length <= 56).
+func (w *LSBBitWriter) WriteBits(value uint64, length uint8) {
+    w.acc |= (value & mask(uint(length))) << w.n
+    w.n += uint(length)
+    for w.n >= 8 {
+        w.buf = append(w.buf, byte(w.acc))
+        w.acc >>= 8
+        w.n -= 8
+    }
+}
+
+// BitsWritten devuelve el número total de bits escritos.
+func (w *LSBBitWriter) BitsWritten() uint64 {
+    return uint64(len(w.buf))*8 + uint64(w.n)
+}
+
+// AlignByte rellena con ceros hasta el siguiente límite de byte.
+func (w *LSBBitWriter) AlignByte() {
+    if w.n > 0 {
+        w.WriteBits(0, uint8(8-w.n))
+    }
+}
+
+// Finalize rellena con ceros el último byte y devuelve el buffer completo.
+func (w *LSBBitWriter) Finalize() []byte {
+    w.AlignByte()
+    return w.buf
+}
+
+// LSBBitReader es el lector correspondiente a LSBBitWriter. Más allá del final
+// devuelve ceros; Overrun indica si se consumieron más bits de los disponibles.
+type LSBBitReader struct {
+    data     []byte
+    pos      int    // siguiente byte a cargar en acc
+    acc      uint64 // bits pendientes; el siguiente bit es el 0
+    n        uint   // número de bits válidos en acc
+    consumed uint64 // bits consumidos en total
+}
+
+func NewLSBBitReader(data []byte) *LSBBitReader {
+    return &LSBBitReader{data: data}
+}
+
+// fill carga bytes en acc hasta tener al menos length bits.
+func (r *LSBBitReader) fill(length uint8) {
+    for r.n < uint(length) {
+        var b byte
+        if r.pos < len(r.data) {
+            b = r.data[r.pos]
+        }
+        r.acc |= uint64(b) << r.n
+        r.n += 8
+        r.pos++
+    }
+}
+
+// Peek devuelve los siguientes length bits (length <= MaxPeekBits) sin
+// consumirlos; el primer bit del flujo queda en el bit 0.
+func (r *LSBBitReader) Peek(length uint8) uint64 {
+    r.fill(length)
+    return r.acc & mask(uint(length))
+}
+
+// Consume descarta length bits (length <= MaxPeekBits), normalmente tras un Peek.
+func (r *LSBBitReader) Consume(length uint8) {
+    r.fill(length)
+    r.acc >>= uint(length)
+    r.n -= uint(length)
+    r.consumed += uint64(length)
+}
+
+// ReadBits lee y consume length bits (length <= MaxPeekBits).
+func (r *LSBBitReader) ReadBits(length uint8) uint64 {
+    v := r.Peek(length)
+    r.Consume(length)
+    return v
+}
+
+// AlignByte descarta los bits que faltan para llegar al siguiente límite de byte.
+func (r *LSBBitReader) AlignByte() {
+    if rem := r.consumed % 8; rem != 0 {
+        r.ReadBits(uint8(8 - rem))
+    }
+}
+
+// BitsConsumed devuelve el número total de bits consumidos.
+func (r *LSBBitReader) BitsConsumed() uint64 {
+    return r.consumed
+}
+
+// BytesConsumed devuelve los bytes usados hasta ahora, contando el último
+// byte parcialmente leído.
+func (r *LSBBitReader) BytesConsumed() int {
+    return int((r.consumed + 7) / 8)
+}
+
+// Overrun indica si se consumieron bits más allá del final de los datos.
+func (r *LSBBitReader) Overrun() bool {
+    return r.consumed > uint64(len(r.data))*8
+}
@@ -0,0 +1,73 @@
+package utils
+
+// Máximo número de bits que Peek puede devolver de una vez.
+const MaxPeekBits = 56
+
+// BitReader lee códigos de longitud variable, bit más significativo primero,
+// desde un []byte. Más allá del final devuelve ceros; Overrun indica si se
+// consumieron más bits de los disponibles.
+type BitReader struct {
+    data     []byte
+    pos      int    // siguiente byte a cargar en acc
+    acc      uint64 // bits pendientes, alineados a la izquierda
+    n        uint   // número de bits válidos en acc
+    consumed uint64 // bits consumidos en total
+}
+
+func NewBitReader(data []byte) *BitReader {
+    return &BitReader{data: data}
+}
+
+func (r *BitReader) refill() {
+    for r.n <= 56 {
+        var b byte
+        if r.pos < len(r.data) {
+            b = r.data[r.pos]
+        }
+        r.acc |= uint64(b) << (56 - r.n)
+        r.n += 8
+        r.pos++
+    }
+}
+
+// Peek devuelve los siguientes length bits (length <= MaxPeekBits) sin consumirlos.
+func (r *BitReader) Peek(length uint8) uint64 {
+    if length == 0 {
+        return 0
+    }
+    if r.n < uint(length) {
+        r.refill()
+    }
+    return r.acc >> (64 - uint(length))
+}
+
+// Consume descarta length bits (length <= MaxPeekBits), normalmente tras un Peek.
+func (r *BitReader) Consume(length uint8) {
+    if r.n < uint(length) {
+        r.refill()
+    }
+    r.acc <<= uint(length)
+    r.n -= uint(length)
+    r.consumed += uint64(length)
+}
+
+// ReadBits lee y consume length bits (length <= 64).
+func (r *BitReader) ReadBits(length uint8) uint64 {
+    if length > MaxPeekBits {
+        hi := r.ReadBits(length - 32)
+        return hi<<32 | r.ReadBits(32)
+    }
+    v := r.Peek(length)
+    r.Consume(length)
+    return v
+}
+
+// BitsConsumed devuelve el número total de bits consumidos.
+func (r *BitReader) BitsConsumed() uint64 {
+    return r.consumed
+}
+
+// Overrun indica si se consumieron bits más allá del final de los datos.
+func (r *BitReader) Overrun() bool {
+    return r.consumed > uint64(len(r.data))*8
+}
@@ -0,0 +1,169 @@
+package utils
+
+import (
+    "io"
+)
+
+// Tamaño del buffer intermedio de los flujos de bits.
+const bitStreamBufSize = 4096
+
+// StreamBitWriter es como BitWriter pero vuelca las palabras completas a un
+// io.Writer en lugar de guardar toda la salida en memoria. El primer error de
+// escritura se conserva y se devuelve en las llamadas siguientes.
+type StreamBitWriter struct {
+    w   io.Writer
+    buf []byte
+    acc uint64 // bits pendientes, alineados a la derecha
+    n   uint   // número de bits válidos en acc (0..63)
+    err error
+}
+
+func NewStreamBitWriter(w io.Writer) *StreamBitWriter {
+    return &StreamBitWriter{w: w, buf: make([]byte, 0, bitStreamBufSize)}
+}
+
+// WriteBits escribe los length bits menos significativos de code (length <= 64).
+func (w *StreamBitWriter) WriteBits(code uint64, length uint8) error {
+    if w.err != nil {
+        return w.err
+    }
+    l := uint(length)
+    code &= mask(l)
+    if w.n+l < 64 {
+        w.acc = w.acc<<l | code
+        w.n += l
+        return nil
+    }
+
+    free := 64 - w.n
+    w.acc = w.acc<<free | code>>(l-free)
+    w.buf = append(w.buf,
+        byte(w.acc>>56), byte(w.acc>>48), byte(w.acc>>40), byte(w.acc>>32),
+        byte(w.acc>>24), byte(w.acc>>16), byte(w.acc>>8), byte(w.acc))
+    w.n = l - free
+    w.acc = code & mask(w.n)
+
+    if len(w.buf)+8 > cap(w.buf) {
+        return w.flushBuf()
+    }
+    return nil
+}
+
+func (w *StreamBitWriter) flushBuf() error {
+    if len(w.buf) > 0 {
+        _, w.err = w.w.Write(w.buf)
+        w.buf = w.buf[:0]
+    }
+    return w.err
+}
+
+// Flush rellena con ceros el último byte y escribe todo lo pendiente. Tras
+// Flush el escritor queda alineado a byte y puede seguir usándose.
+func (w *StreamBitWriter) Flush() error {
+    if w.err != nil {
+        return w.err
+    }
+    for w.n >= 8 {
+        w.n -= 8
+        w.buf = append(w.buf, byte(w.acc>>w.n))
+    }
+    if w.n > 0 {
+        w.buf = append(w.buf, byte(w.acc<<(8-w.n)))
+        w.n = 0
+    }
+    w.acc = 0
+    return w.flushBuf()
+}
+
+// StreamBitReader es como BitReader pero lee de un io.Reader a medida que
+// necesita bits. Más allá del final Peek devuelve ceros; Consume informa el
+// error cuando se consumen bits que no existen.
+type StreamBitReader struct {
+    r        io.Reader
+    buf      []byte
+    start    int    // siguiente byte de buf a cargar en acc
+    acc      uint64 // bits pendientes, alineados a la izquierda
+    n        uint   // número de bits válidos en acc
+    avail    uint64 // bits reales leídos del flujo
+    consumed uint64 // bits consumidos en total
+    err      error  // error de lectura distinto de io.EOF
+    eof      bool
+}
+
+func NewStreamBitReader(r io.Reader) *StreamBitReader {
+    return &StreamBitReader{r: r, buf: make([]byte, 0, bitStreamBufSize)}
+}
+
+func (r *StreamBitReader) refill() {
+    for r.n <= 56 {
+        if r.start == len(r.buf) && !r.eof {
+            n, err := r.r.Read(r.buf[:cap(r.buf)])
+            r.buf, r.start = r.buf[:n], 0
+            if err == io.EOF {
+                r.eof = true
+            } else if err != nil {
+                r.err = err
+                r.eof = true
+            }
+            if n == 0 && !r.eof {
+                continue
+            }
+        }
+        var b byte
+        if r.start < len(r.buf) {
+            b = r.buf[r.start]
+            r.start++
+            r.avail += 8
+        }
+        r.acc |= uint64(b) << (56 - r.n)
+        r.n += 8
+    }
+}
+
+// Peek devuelve los siguientes length bits (length <= MaxPeekBits) sin consumirlos.
+func (r *StreamBitReader) Peek(length uint8) uint64 {
+    if length == 0 {
+        return 0
+    }
+    if r.n < uint(length) {
+        r.refill()
+    }
+    return r.acc >> (64 - uint(length))
+}
+
+// Consume descarta length bits (length <= MaxPeekBits). Devuelve el error de
+// lectura del flujo, o io.ErrUnexpectedEOF si los datos se terminaron.
+func (r *StreamBitReader) Consume(length uint8) error {
+    if r.n < uint(length) {
+        r.refill()
+    }
+    r.acc <<= uint(length)
+    r.n -= uint(length)
+    r.consumed += uint64(length)
+    if r.consumed > r.avail {
+        if r.err != nil {
+            return r.err
+        }
+        return io.ErrUnexpectedEOF
+    }
+    return nil
+}
+
+// ReadBits lee y consume length bits (length <= 64).
+func (r *StreamBitReader) ReadBits(length uint8) (uint64, error) {
+    if length > MaxPeekBits {
+        hi, err := r.ReadBits(length - 32)
+        if err != nil {
+            return 0, err
+        }
+        lo, err := r.ReadBits(32)
+        return hi<<32 | lo, err
+    }
+    v := r.Peek(length)
+    return v, r.Consume(length)
+}
+
+// BitsConsumed devuelve el número total de bits consumidos.
+func (r *StreamBitReader) BitsConsumed() uint64 {
+    return r.consumed
+}
@@ -0,0 +1,66 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math/rand"
+	"testing"
+	"testing/iotest"
+)
+
+// TestBitStream escribe los mismos códigos con BitWriter y StreamBitWriter,
+// los relee de a un byte con StreamBitReader y comprueba la propagación de errores.
+func TestBitStream(t *testing.T) {
+	rng := rand.New(rand.NewSource(34))
+	type code struct {
+		bits   uint64
+		length uint8
+	}
+	codes := make([]code, 5000)
+	var bw BitWriter
+	var buf bytes.Buffer
+	sw := NewStreamBitWriter(&buf)
+	for i := range codes {
+		codes[i].length = uint8(1 + rng.Intn(64))
+		codes[i].bits = rng.Uint64() >> (64 - codes[i].length)
+		bw.WriteBits(codes[i].bits, codes[i].length)
+		if err := sw.WriteBits(codes[i].bits, codes[i].length); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := sw.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), bw.Finalize()) {
+		t.Fatal("StreamBitWriter difiere de BitWriter")
+	}
+
+	sr := NewStreamBitReader(iotest.OneByteReader(&buf))
+	for i, c := range codes {
+		v, err := sr.ReadBits(c.length)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v != c.bits {
+			t.Fatalf("código %d: leído %x, esperado %x", i, v, c.bits)
+		}
+	}
+	if _, err := sr.ReadBits(16); err != io.ErrUnexpectedEOF {
+		t.Fatalf("lectura tras el final: %v, esperado %v", err, io.ErrUnexpectedEOF)
+	}
+
+	werr := errors.New("disco lleno")
+	sw = NewStreamBitWriter(errWriter{werr})
+	for i := 0; i < 1000; i++ {
+		sw.WriteBits(uint64(i), 64)
+	}
+	if err := sw.Flush(); err != werr {
+		t.Fatalf("error de escritura %v, esperado %v", err, werr)
+	}
+}
+
+// errWriter falla en todas las escrituras.
+type errWriter struct{ err error }
+
+func (w errWriter) Write(p []byte) (int, error) { return 0, w.err }
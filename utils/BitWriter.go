@@ -1,37 +1,57 @@
 package utils
 
+// BitWriter escribe códigos de longitud variable, bit más significativo
+// primero. Acumula hasta 64 bits antes de volcarlos al buffer.
 type BitWriter struct {
-    buf  []byte
-    curr byte
-    n    int // number of bits written into curr (0..7)
+    buf []byte
+    acc uint64 // bits pendientes, alineados a la derecha
+    n   uint   // número de bits válidos en acc (0..63)
+}
+
+// mask devuelve los length bits menos significativos a 1.
+func mask(length uint) uint64 {
+    return uint64(1)<<length - 1
 }
 
 func (w *BitWriter) WriteBit(bit byte) {
-    w.curr <<= 1
-    w.curr |= bit & 1
-    w.n++
+    w.WriteBits(uint64(bit&1), 1)
+}
 
-    if w.n == 8 {
-        w.buf = append(w.buf, w.curr)
-        w.curr = 0
-        w.n = 0
+// WriteBits escribe los length bits menos significativos de code (length <= 64).
+func (w *BitWriter) WriteBits(code uint64, length uint8) {
+    l := uint(length)
+    code &= mask(l)
+    if w.n+l < 64 {
+        w.acc = w.acc<<l | code
+        w.n += l
+        return
     }
+
+    // Completar 64 bits, volcarlos y dejar el resto en el acumulador
+    free := 64 - w.n
+    w.acc = w.acc<<free | code>>(l-free)
+    w.buf = append(w.buf,
+        byte(w.acc>>56), byte(w.acc>>48), byte(w.acc>>40), byte(w.acc>>32),
+        byte(w.acc>>24), byte(w.acc>>16), byte(w.acc>>8), byte(w.acc))
+    w.n = l - free
+    w.acc = code & mask(w.n)
 }
 
-func (w *BitWriter) WriteBits(code string) {
-    for i := 0; i < len(code); i++ {
-        if code[i] == '0' {
-            w.WriteBit(0)
-        } else {
-            w.WriteBit(1)
-        }
-    }
+// BitsWritten devuelve el número total de bits escritos.
+func (w *BitWriter) BitsWritten() uint64 {
+    return uint64(len(w.buf))*8 + uint64(w.n)
 }
 
+// Finalize rellena con ceros el último byte y devuelve el buffer completo.
 func (w *BitWriter) Finalize() []byte {
+    for w.n >= 8 {
+        w.n -= 8
+        w.buf = append(w.buf, byte(w.acc>>w.n))
+    }
     if w.n > 0 {
-        w.curr <<= uint(8 - w.n)
-        w.buf = append(w.buf, w.curr)
+        w.buf = append(w.buf, byte(w.acc<<(8-w.n)))
+        w.n = 0
     }
+    w.acc = 0
     return w.buf
-}
\ No newline at end of file
+}
@@ -2,7 +2,7 @@ package utils
 
 
 type Node struct {
-	Symbol byte
+	Symbol int
 	Freq   int
 	Left   *Node
 	Right  *Node
@@ -71,15 +71,23 @@ func (heap *MinHeap) Pop() *Node {
 }
 
 func BuildHeap(data []byte) MinHeap {
-	freqTable := make(map[byte]int)
+	var freqTable [256]int
 
 	for _, b := range data {
 		freqTable[b]++
 	}
 
+	return BuildHeapFromFreq(freqTable[:])
+}
+
+// BuildHeapFromFreq inserta los símbolos en orden ascendente para que el
+// árbol resultante no dependa del orden de iteración de un map.
+func BuildHeapFromFreq(freqTable []int) MinHeap {
 	heap := MinHeap{}
-	for b, freq := range freqTable {
-		heap.Insert(&Node{Symbol: b, Freq: freq, Left: nil, Right: nil})
+	for s, freq := range freqTable {
+		if freq > 0 {
+			heap.Insert(&Node{Symbol: s, Freq: freq, Left: nil, Right: nil})
+		}
 	}
 
 	return heap